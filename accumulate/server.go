@@ -16,14 +16,15 @@ import (
 // Miners create submissions that are recorded on
 // acc://miningService/submissions scratch data account
 type Submission struct {
-	Valid      bool      // Not Persisted. Assumed valid, set to false if invalid
-	TimeStamp  time.Time //  8 Miner reported timestamp
-	DNIndex    uint64    //  8 Directory Network minor block index
-	DNHash     [32]byte  // 40 Directory Network Index
-	BlockIndex uint64    // 48 Mining Block Index
-	Nonce      uint64    // 56 Nonce solution
-	MinerIdx   uint64    // 64 Index into the Miners Account
-	PoW        uint64    // 72 Self reported Difficulty
+	Valid      bool       // Not Persisted. Assumed valid, set to false if invalid
+	TimeStamp  time.Time  //  8 Miner reported timestamp
+	DNIndex    uint64     //  8 Directory Network minor block index
+	DNHash     [32]byte   // 40 Directory Network Index
+	BlockIndex uint64     // 48 Mining Block Index
+	Nonce      uint64     // 56 Nonce solution
+	MinerIdx   uint64     // 64 Index into the Miners Account
+	PoW        uint64     // 72 Self reported Difficulty
+	PoW256     pow.Pow256 // 104 Self reported 256 bit Difficulty (when Settings use Difficulty256)
 }
 
 // Miner
@@ -60,21 +61,25 @@ type PointsReport struct {
 // Settings
 // Mostly we update the Difficult
 type Settings struct {
-	TimeStamp        time.Time //  8 - Timestamp (persisted in nanoseconds)
-	WindowBlockIndex uint64    //  8 - Window Index of start of difficulty adjustment
-	WindowTimestamp  time.Time //  8 - Timestamp (persisted in nanoseconds)
-	DiffWindow       uint16    //  2 - Adjustment window in proof of work blocks
-	DNIndex          uint64    //  8 - Miner block height
-	LastDiff         uint64    //  8 - Difficulty of the last rewarded (300 or less)
-	BlockIndex       uint64    //  8 - Block Index of activation for this set of settings
-	Loops            uint16    //  2 - Loops over the hash (more loops, slower hash)
-	Bits             uint16    //  2 - Number of bits addressing the ByteMap (30 = 1 GB)
-	DNHash           [32]byte  // 32 - Hash to be mined
-	Difficulty       uint64    //  8 - Difficulty that marks the end of the Block
-	BlockTime        uint16    //  2 - Target block time in seconds per block
-	PayoutFreq       uint64    //  8 - Payouts per 24 hours (starting at 0:00 UTC)
-	Qualifies        uint64    //  8 - Number of submissions that are given points in a block
-	//                           112 Bytes gross total bytes
+	TimeStamp        time.Time  //  8 - Timestamp (persisted in nanoseconds)
+	WindowBlockIndex uint64     //  8 - Window Index of start of difficulty adjustment
+	WindowTimestamp  time.Time  //  8 - Timestamp (persisted in nanoseconds)
+	DiffWindow       uint16     //  2 - Adjustment window in proof of work blocks
+	DNIndex          uint64     //  8 - Miner block height
+	LastDiff         uint64     //  8 - Difficulty of the last rewarded (300 or less)
+	BlockIndex       uint64     //  8 - Block Index of activation for this set of settings
+	Loops            uint16     //  2 - Loops over the hash (more loops, slower hash)
+	Bits             uint16     //  2 - Number of bits addressing the ByteMap (30 = 1 GB)
+	Passes           uint16     //  2 - Passes shuffling the ByteMap
+	AlgorithmID      uint16     //  2 - PoW algorithm active from BlockIndex (see pow.AlgorithmID)
+	AlgorithmVersion uint16     //  2 - Version of the PoW algorithm
+	DNHash           [32]byte   // 32 - Hash to be mined
+	Difficulty       uint64     //  8 - Difficulty that marks the end of the Block
+	BlockTime        uint16     //  2 - Target block time in seconds per block
+	PayoutFreq       uint64     //  8 - Payouts per 24 hours (starting at 0:00 UTC)
+	Qualifies        uint64     //  8 - Number of submissions that are given points in a block
+	Difficulty256    pow.Pow256 // 32 - 256 bit Difficulty; if not zero, used in place of Difficulty
+	//                           150 Bytes gross total bytes
 }
 
 // MAdi
@@ -88,7 +93,9 @@ type MAdi struct {
 	Validators   map[string]uint64 // A look up table to make finding a validator index fast
 	ValidatorIdx []string          // The actual list of validators as then are registered
 	PointsReport []PointsReport    // Reports of points earned by miners
+	Block        uint64            // Index of the block being mined
 	LX           *pow.LxrPow       // Not persisted.
+	Manager      *pow.Manager      // Not persisted. Algorithms for each Settings; if nil, LX is used
 }
 
 var MAdiMutex sync.RWMutex
@@ -121,6 +128,9 @@ func init() {
 	settings.BlockIndex = 1                                // Start at the first block
 	settings.Loops = 32                                    // LXPow: number of loops over the hash
 	settings.Bits = 16                                     // LXPow: Number of bits in the Byte Map lookup
+	settings.Passes = 6                                    // LXPow: Number of shuffles of the Byte Map
+	settings.AlgorithmID = uint16(pow.AlgorithmLxrPoW)     // Mine with LxrPoW
+	settings.AlgorithmVersion = 1                          // Version 1 uses the original ByteMap generator
 	settings.DNHash = sha256.Sum256([]byte("first block")) // Hash of the first DNBlock to be mined
 	settings.Difficulty = 0xFFFFF00000000000               // A Starting difficulty target
 	settings.BlockTime = 600                               // 10 minutes
@@ -128,6 +138,7 @@ func init() {
 	settings.Qualifies = 100                               // How many submissions get points
 
 	MiningADI.Settings = append(MiningADI.Settings, *settings)
+	MiningADI.Block = settings.BlockIndex
 }
 
 // RegisterMiner
@@ -181,13 +192,124 @@ func (m *MAdi) RegisterValidator(bookUrl string) (validatorIdx uint64) {
 }
 
 // Sync
-// Syncs with the Accumulate Protocol so we can trust our data.
-// If a nil is returned, then Syncing failed.
+// Syncs with the Accumulate Protocol so we can trust our data, and returns the
+// settings of the block being mined.  Settings recorded for later blocks are not
+// returned until their block is mined.
 func (m *MAdi) Sync() Settings {
 	MAdiMutex.Lock()
 	defer MAdiMutex.Unlock()
+	if settings, ok := m.settingsAt(m.Block); ok {
+		return settings
+	}
 	return m.Settings[len(m.Settings)-1]
+}
+
+// CurrentBlock returns the index of the block being mined
+func (m *MAdi) CurrentBlock() uint64 {
+	MAdiMutex.Lock()
+	defer MAdiMutex.Unlock()
+	return m.Block
+}
+
+// SettingsAt
+// Returns the settings in effect at the given block index; the settings record
+// with the latest activation BlockIndex that is not after it.  Returns false if no
+// settings are active yet.
+func (m *MAdi) SettingsAt(blockIndex uint64) (settings Settings, ok bool) {
+	MAdiMutex.Lock()
+	defer MAdiMutex.Unlock()
+	return m.settingsAt(blockIndex)
+}
+
+// settingsAt is SettingsAt with MAdiMutex held.  Records scheduled for later blocks
+// may come before records of earlier ones; of those activating at the same block,
+// the last recorded wins.
+func (m *MAdi) settingsAt(blockIndex uint64) (settings Settings, ok bool) {
+	for i := len(m.Settings) - 1; i >= 0; i-- {
+		s := m.Settings[i]
+		if s.BlockIndex <= blockIndex && (!ok || s.BlockIndex > settings.BlockIndex) {
+			settings, ok = s, true
+		}
+	}
+	return settings, ok
+}
+
+// AlgorithmAt
+// Returns a lease on the PoW algorithm of the settings active at the given block
+// index, to be released once the algorithm is no longer used.  If there is no
+// Manager, the lease holds LX, and if there is no LX either, it holds nothing.
+func (m *MAdi) AlgorithmAt(blockIndex uint64) (*pow.Lease, error) {
+	settings, ok := m.SettingsAt(blockIndex)
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("no settings are active at block %d", blockIndex)
+	case m.Manager != nil:
+		return m.Manager.Get(settings.AlgorithmKey())
+	case m.LX != nil:
+		return &pow.Lease{Alg: m.LX}, nil
+	}
+	return &pow.Lease{}, nil
+}
 
+// Scheduled
+// Returns the keys of the PoW algorithms of the settings of the block being mined,
+// and of every settings record that activates at a later block, so they can be
+// prepared in advance.  The key of the block before is kept too, so submissions
+// arriving late for it are checked without building its ByteMap again.
+func (m *MAdi) Scheduled() (keys []pow.AlgorithmKey) {
+	MAdiMutex.Lock()
+	defer MAdiMutex.Unlock()
+	if previous, ok := m.settingsAt(m.Block - 1); ok && m.Block > 0 {
+		keys = append(keys, previous.AlgorithmKey())
+	}
+	if current, ok := m.settingsAt(m.Block); ok {
+		keys = append(keys, current.AlgorithmKey())
+	}
+	for _, s := range m.Settings {
+		if s.BlockIndex > m.Block {
+			keys = append(keys, s.AlgorithmKey())
+		}
+	}
+	return keys
+}
+
+// AlgorithmKey
+// The PoW algorithm these settings activate.  Settings recorded before algorithms
+// were named have no AlgorithmID, and mined LxrPoW with the legacy generator and
+// 6 passes.
+func (s Settings) AlgorithmKey() pow.AlgorithmKey {
+	if s.AlgorithmID == 0 {
+		return pow.AlgorithmKey{ID: pow.AlgorithmLxrPoW, Version: uint16(pow.GeneratorLegacy),
+			Loops: int(s.Loops), Bits: int(s.Bits), Passes: 6}
+	}
+	return pow.AlgorithmKey{ID: pow.AlgorithmID(s.AlgorithmID), Version: s.AlgorithmVersion,
+		Loops: int(s.Loops), Bits: int(s.Bits), Passes: int(s.Passes)}
+}
+
+// Uses256
+// Reports if the settings opt into 256 bit PoW, by setting Difficulty256
+func (s Settings) Uses256() bool {
+	return !s.Difficulty256.IsZero()
+}
+
+// EndsBlock
+// Reports if the submission meets the difficulty that ends the block; the
+// Difficulty256 if the settings use it, else the Difficulty.
+func (s Settings) EndsBlock(submission Submission) bool {
+	if s.Uses256() {
+		return submission.PoW256.Cmp(s.Difficulty256) >= 0
+	}
+	return submission.PoW >= s.Difficulty
+}
+
+// Less
+// Reports if the submission represents less work than the other.  Submissions are
+// ordered by their 64 bit PoW, and ties are broken by their 256 bit PoW.
+func (s Submission) Less(other Submission) bool {
+	if s.PoW != other.PoW {
+		return s.PoW < other.PoW
+	}
+	return s.PoW256.Less(other.PoW256)
 }
 
 // GetBlock
@@ -204,7 +326,11 @@ func (m *MAdi) GetBlock() (DNHash [32]byte, submissions []Submission) {
 		MAdiMutex.Unlock()
 		return settings.DNHash, submissions
 	}
-	raw := append([]Submission{}, m.Submissions[settings.BlockIndex:]...)
+	start := settings.BlockIndex // Submissions of earlier blocks come first
+	if start > uint64(len(m.Submissions)) {
+		start = 0
+	}
+	raw := append([]Submission{}, m.Submissions[start:]...)
 	MAdiMutex.Unlock()
 	var clean []Submission
 
@@ -218,29 +344,105 @@ func (m *MAdi) GetBlock() (DNHash [32]byte, submissions []Submission) {
 
 		clean = append(clean, sub)
 	}
-	sort.Slice(clean, func(i, j int) bool { return clean[i].PoW < clean[j].PoW })
+	sort.Slice(clean, func(i, j int) bool { return clean[i].Less(clean[j]) })
 	return settings.DNHash, clean
 }
 
 // AddSubmission
 // Does quality checks on the submission to avoid adding submissions
-// that cannot win points and wasting credits.
+// that cannot win points and wasting credits.  Submissions are accepted for the
+// block being mined, and late for the block before; each is checked with the
+// settings and PoW algorithm of its own block.
 func (m *MAdi) AddSubmission(sub Submission) error {
-	settings := m.Sync()
-	_, submissions := m.GetBlock()
-	if len(submissions) > 0 && submissions[len(submissions)-1].PoW >= settings.Difficulty {
-		return nil // A solution has already been found
+	current := m.CurrentBlock()
+	if sub.BlockIndex > current || sub.BlockIndex+1 < current {
+		return nil // Not mined yet, or its block's submission window has closed
+	}
+	settings, ok := m.SettingsAt(sub.BlockIndex)
+	if !ok || !checkSubmission(settings, sub) { // Checked before its algorithm is built
+		return nil
+	}
+	if sub.BlockIndex == current {
+		_, submissions := m.GetBlock()
+		if len(submissions) > 0 && settings.EndsBlock(submissions[len(submissions)-1]) {
+			return nil // A solution has already been found
+		}
 	}
-	if ValidateSubmission(m.LX,settings,sub) {
+	lease, err := m.AlgorithmAt(sub.BlockIndex)
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+	if ValidateSubmission(lease.Alg, settings, sub) {
 		MAdiMutex.Lock()
-		m.Submissions = append(m.Submissions,sub)
+		m.Submissions = append(m.Submissions, sub)
 		MAdiMutex.Unlock()
 	}
 
 	return nil
 }
 
-func ValidateSubmission(LX *pow.LxrPow, settings Settings, submission Submission) bool {
+// ValidateSubmission
+// Validates a submission against the settings of its block, using the PoW
+// algorithm those settings activate.  If alg is nil, the PoW is not checked.
+func ValidateSubmission(alg pow.Algorithm, settings Settings, submission Submission) bool {
+	switch {
+	case !checkSubmission(settings, submission):
+		return false
+	case alg != nil && !verifyPoW(alg, settings, submission):
+		return false
+	}
+
+	return true
+}
+
+// verifyPoW checks the PoW a submission claims.  When the settings use a 256 bit
+// difficulty, the 256 bit PoW is checked too, and must lead with the 64 bit PoW.
+func verifyPoW(alg pow.Algorithm, settings Settings, submission Submission) bool {
+	if !settings.Uses256() {
+		return alg.Verify(submission.DNHash[:], submission.Nonce, submission.PoW)
+	}
+	alg256, ok := alg.(pow.Algorithm256)
+	return ok && submission.PoW256.Uint64() == submission.PoW &&
+		alg256.Verify256(submission.DNHash[:], submission.Nonce, submission.PoW256)
+}
+
+// ValidateSubmissions
+// Validates a list of submissions, returning true for each one that is valid.
+// When alg is an LxrPow, the PoW of all the submissions are computed together,
+// which is much faster than calling ValidateSubmission for each.
+func ValidateSubmissions(alg pow.Algorithm, settings Settings, submissions []Submission) []bool {
+	valid := make([]bool, len(submissions))
+	var nonces []uint64
+	var idx []int // Index of the submission for each nonce
+	for i, sub := range submissions {
+		if valid[i] = checkSubmission(settings, sub); valid[i] {
+			nonces = append(nonces, sub.Nonce)
+			idx = append(idx, i)
+		}
+	}
+	lx, batched := alg.(*pow.LxrPow)
+	switch {
+	case alg == nil:
+		return valid
+	case !batched || settings.Uses256():
+		for _, i := range idx {
+			valid[i] = verifyPoW(alg, settings, submissions[i])
+		}
+		return valid
+	}
+
+	// Every valid submission is on the DNHash in the settings
+	pows := make([]uint64, len(nonces))
+	lx.LxrPoWBatch(settings.DNHash[:], nonces, pows)
+	for j, i := range idx {
+		valid[i] = pows[j] == submissions[i].PoW
+	}
+	return valid
+}
+
+// checkSubmission checks everything about a submission but its PoW
+func checkSubmission(settings Settings, submission Submission) bool {
 	switch {
 	case settings.BlockIndex != submission.BlockIndex:
 		return false
@@ -250,17 +452,30 @@ func ValidateSubmission(LX *pow.LxrPow, settings Settings, submission Submission
 		return false
 	case MiningADI.GetMinerUrl(submission.MinerIdx) == "":
 		return false
-	case LX != nil && LX.LxrPoW(submission.DNHash[:], submission.Nonce) != submission.PoW:
-		return false
 	}
-
 	return true
 }
 
 // AddSettings
-// Add a Settings Record to the Settings Account
+// Add a Settings Record to the Settings Account.  Records may be scheduled for a
+// later block; they take effect when that block is mined.
 func (m *MAdi) AddSettings(settings Settings) {
 	MAdiMutex.Lock()
 	defer MAdiMutex.Unlock()
 	m.Settings = append(m.Settings, settings)
 }
+
+// EndBlock
+// Records the settings of the next block, and makes it the block being mined.  If
+// a settings record was scheduled to activate after the current block and by the
+// next, the next block mines with its PoW algorithm.
+func (m *MAdi) EndBlock(settings Settings) {
+	MAdiMutex.Lock()
+	defer MAdiMutex.Unlock()
+	if s, ok := m.settingsAt(settings.BlockIndex); ok && s.BlockIndex > m.Block {
+		settings.AlgorithmID, settings.AlgorithmVersion = s.AlgorithmID, s.AlgorithmVersion
+		settings.Loops, settings.Bits, settings.Passes = s.Loops, s.Bits, s.Passes
+	}
+	m.Settings = append(m.Settings, settings)
+	m.Block = settings.BlockIndex
+}
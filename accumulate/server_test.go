@@ -0,0 +1,237 @@
+package accumulate
+
+import (
+	"crypto/sha256"
+	"reflect"
+	"testing"
+
+	"github.com/pegnet/LXRPow/pow"
+)
+
+// testSettings returns settings activating at the block, mining LxrPoW with the loops
+func testSettings(block uint64, loops uint16) Settings {
+	return Settings{
+		BlockIndex:       block,
+		DNIndex:          100 + block,
+		DNHash:           sha256.Sum256([]byte{byte(block)}),
+		Loops:            loops,
+		Bits:             10,
+		Passes:           6,
+		AlgorithmID:      uint16(pow.AlgorithmLxrPoW),
+		AlgorithmVersion: uint16(pow.GeneratorLegacy),
+		Difficulty:       0xFFFFFFFFFFFFFFFF,
+	}
+}
+
+func TestSettingsAt(t *testing.T) {
+	m := &MAdi{Settings: []Settings{
+		testSettings(1, 8),
+		testSettings(5, 32), // Scheduled before the records of earlier blocks
+		testSettings(2, 8),
+		testSettings(3, 8),
+		testSettings(3, 9), // Recorded last, so it wins over the first record of block 3
+	}}
+	tests := []struct {
+		block uint64
+		ok    bool
+		loops uint16
+	}{
+		{0, false, 0}, {1, true, 8}, {2, true, 8}, {3, true, 9}, {4, true, 9}, {5, true, 32}, {9, true, 32},
+	}
+	for _, test := range tests {
+		s, ok := m.SettingsAt(test.block)
+		if ok != test.ok || s.Loops != test.loops {
+			t.Errorf("block %d: got loops %d, %v; expected %d, %v", test.block, s.Loops, ok, test.loops, test.ok)
+		}
+	}
+}
+
+func TestScheduled(t *testing.T) {
+	key := func(loops uint16) pow.AlgorithmKey { return testSettings(0, loops).AlgorithmKey() }
+	m := &MAdi{Settings: []Settings{testSettings(1, 8)}, Block: 1}
+	m.AddSettings(testSettings(3, 16)) // Changes the PoW from block 3
+
+	// Each block ends with settings from the block before; the change scheduled for
+	// block 3 must still take effect there
+	steps := []struct {
+		end       uint64 // Block ended into; 0 for none
+		loops     uint16 // Loops mined after
+		scheduled []pow.AlgorithmKey
+	}{
+		{0, 8, []pow.AlgorithmKey{key(8), key(16)}},
+		{2, 8, []pow.AlgorithmKey{key(8), key(8), key(16)}},
+		{3, 16, []pow.AlgorithmKey{key(8), key(16)}},
+		{4, 16, []pow.AlgorithmKey{key(16), key(16)}},
+	}
+	for _, step := range steps {
+		if step.end != 0 {
+			next := m.Sync()
+			next.BlockIndex = step.end
+			m.EndBlock(next)
+		}
+		if got := m.Sync(); got.Loops != step.loops || m.CurrentBlock() != got.BlockIndex {
+			t.Errorf("block %d: mining loops %d at block %d, expected loops %d", m.CurrentBlock(), got.Loops, got.BlockIndex, step.loops)
+		}
+		if got := m.Scheduled(); !reflect.DeepEqual(got, step.scheduled) {
+			t.Errorf("block %d: scheduled %v, expected %v", m.CurrentBlock(), got, step.scheduled)
+		}
+	}
+}
+
+func TestAlgorithmAt(t *testing.T) {
+	lx, err := pow.New(pow.Options{Loops: 8, Bits: 10, Passes: 6, Store: pow.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	m := &MAdi{Settings: []Settings{testSettings(1, 8), testSettings(2, 16)}, Block: 2}
+
+	if _, err := m.AlgorithmAt(0); err == nil {
+		t.Error("expected an error before any settings are active")
+	}
+	if lease, err := m.AlgorithmAt(1); err != nil || lease.Alg != nil {
+		t.Errorf("expected no algorithm without a Manager or LX, got %v, %v", lease, err)
+	}
+	m.LX = lx
+	if lease, err := m.AlgorithmAt(2); err != nil || lease.Alg != pow.Algorithm(lx) {
+		t.Errorf("expected LX without a Manager, got %v, %v", lease, err)
+	}
+	m.Manager = pow.NewManager(pow.Options{Store: pow.NewMemStore()})
+	defer m.Manager.Close()
+	for block, loops := range map[uint64]uint16{1: 8, 2: 16} {
+		lease, err := m.AlgorithmAt(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := testSettings(block, loops).AlgorithmKey(); lease.Alg.Key() != want {
+			t.Errorf("block %d: got %v, expected %v", block, lease.Alg.Key(), want)
+		}
+		lease.Release()
+	}
+}
+
+func TestAddSubmission(t *testing.T) {
+	m := &MAdi{Settings: []Settings{testSettings(1, 8), testSettings(2, 8), testSettings(3, 8)}, Block: 3}
+	m.AddSettings(testSettings(4, 16)) // Scheduled; its ByteMap must not be built for a submission
+	m.Manager = pow.NewManager(pow.Options{Store: pow.NewMemStore()})
+	defer m.Manager.Close()
+	lease, err := m.Manager.Get(testSettings(0, 8).AlgorithmKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lease.Release()
+	minerIdx := MiningADI.RegisterMiner("acc://submitter.acme/tokens")
+
+	// submission returns a submission for the block, with its PoW unless wrong is set
+	submission := func(block, nonce uint64, wrong bool) Submission {
+		s := testSettings(block, 8)
+		sub := Submission{BlockIndex: block, DNHash: s.DNHash, DNIndex: s.DNIndex, MinerIdx: minerIdx, Nonce: nonce}
+		sub.PoW, _ = lease.Alg.PoW(s.DNHash[:], nonce)
+		if wrong {
+			sub.PoW++
+		}
+		return sub
+	}
+	otherHash := submission(3, 4, false)
+	otherHash.DNHash[0]++
+	tests := []struct {
+		name     string
+		sub      Submission
+		accepted bool
+	}{
+		{"current block", submission(3, 1, false), true},
+		{"wrong PoW", submission(3, 2, true), false},
+		{"wrong hash", otherHash, false},
+		{"late for the block before", submission(2, 3, false), true},
+		{"window closed", submission(1, 5, false), false},
+		{"future block", submission(4, 6, false), false},
+	}
+	for _, test := range tests {
+		before := len(m.Submissions)
+		if err := m.AddSubmission(test.sub); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if accepted := len(m.Submissions) > before; accepted != test.accepted {
+			t.Errorf("%s: accepted is %v, expected %v", test.name, accepted, test.accepted)
+		}
+	}
+	if m.Manager.Ready(testSettings(4, 16).AlgorithmKey()) {
+		t.Error("a submission for a future block built its algorithm")
+	}
+}
+
+func TestEndsBlock(t *testing.T) {
+	s := testSettings(1, 8)
+	s.Difficulty = 0xFFF0000000000000
+	tests := []struct {
+		name   string
+		s256   pow.Pow256 // Difficulty256; zero to use the 64 bit Difficulty
+		sub    Submission
+		expect bool
+	}{
+		{"64 bit below", pow.Pow256{}, Submission{PoW: 0xFFEFFFFFFFFFFFFF}, false},
+		{"64 bit equal", pow.Pow256{}, Submission{PoW: 0xFFF0000000000000}, true},
+		{"256 bit below", pow.Pow256{0xFF, 0xF0, 31: 1}, Submission{PoW256: pow.Pow256{0xFF, 0xF0}}, false},
+		{"256 bit equal", pow.Pow256{0xFF, 0xF0, 31: 1}, Submission{PoW256: pow.Pow256{0xFF, 0xF0, 31: 1}}, true},
+		{"256 bit ignores the 64 bit PoW", pow.Pow256{0xFF, 0xF1}, Submission{PoW: 0xFFFFFFFFFFFFFFFF}, false},
+	}
+	for _, test := range tests {
+		s.Difficulty256 = test.s256
+		if got := s.EndsBlock(test.sub); got != test.expect {
+			t.Errorf("%s: EndsBlock is %v, expected %v", test.name, got, test.expect)
+		}
+	}
+}
+
+func TestSubmissionLess(t *testing.T) {
+	low := Submission{PoW: 1, PoW256: pow.Pow256{0xFF}}
+	high := Submission{PoW: 2}
+	tieLow := Submission{PoW: 2, PoW256: pow.Pow256{31: 1}}
+	if !low.Less(high) || high.Less(low) {
+		t.Error("submissions must be ordered by their 64 bit PoW first")
+	}
+	if !high.Less(tieLow) || tieLow.Less(high) {
+		t.Error("ties of the 64 bit PoW must be broken by the 256 bit PoW")
+	}
+	if high.Less(high) {
+		t.Error("a submission is not less than itself")
+	}
+}
+
+func TestValidateSubmissions(t *testing.T) {
+	lx, err := pow.New(pow.Options{Loops: 8, Bits: 10, Passes: 6, Store: pow.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	minerIdx := MiningADI.RegisterMiner("acc://validated.acme/tokens")
+	s := testSettings(1, 8)
+
+	valid := func(nonce uint64) Submission {
+		p256 := lx.LxrPoW256(s.DNHash[:], nonce)
+		return Submission{BlockIndex: 1, DNHash: s.DNHash, DNIndex: s.DNIndex, MinerIdx: minerIdx,
+			Nonce: nonce, PoW: p256.Uint64(), PoW256: p256}
+	}
+	wrong64, wrong256, unled := valid(2), valid(3), valid(4)
+	wrong64.PoW++
+	wrong256.PoW256[31]++
+	unled.PoW = valid(5).PoW // The 256 bit PoW must lead with the 64 bit PoW
+	subs := []Submission{valid(1), wrong64, wrong256, unled}
+
+	// The 64 bit path, batched for an LxrPow, only checks the 64 bit PoW
+	if got, expect := ValidateSubmissions(lx, s, subs), []bool{true, false, true, false}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("64 bit: got %v, expected %v", got, expect)
+	}
+	s.Difficulty256 = pow.Pow256FromUint64(s.Difficulty)
+	if got, expect := ValidateSubmissions(lx, s, subs), []bool{true, false, false, false}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("256 bit: got %v, expected %v", got, expect)
+	}
+	for i, sub := range subs {
+		if got := ValidateSubmission(lx, s, sub); got != (i == 0) {
+			t.Errorf("256 bit: submission %d is valid: %v", i, got)
+		}
+	}
+	if !ValidateSubmission(nil, s, wrong256) {
+		t.Error("the PoW must not be checked without an algorithm")
+	}
+}
@@ -3,11 +3,13 @@
 package cfg
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/binary"
 	"flag"
 	"fmt"
+	"log/slog"
 	"math"
 	"math/big"
 	"net/url"
@@ -15,24 +17,58 @@ import (
 	"time"
 
 	"github.com/pegnet/LXRPow/accumulate"
+	"github.com/pegnet/LXRPow/hashing"
 	"github.com/pegnet/LXRPow/pow"
 )
 
 type Config struct {
-	Index      uint64      // Index of this mining instance
-	TokenURL   string      // URL for rewards
-	Instances  int         // How many hashers to run
-	MinerCnt   int         // Number of miners to run
-	Loop       int         // How many times we loop over a hash computing PoW
-	Bits       int         // Number of bits in the size of the ByteMap (30 == 1GB ByteMap)
-	Phrase     string      // A phrase used to create the seed nonce for mining
-	Randomize  bool        // Use an OS generated random number to avoid seed collisions
-	Difficulty uint64      // The difficulty limit (if using difficulty to end mining blocks)
-	DiffWindow int         // Determines Difficulty adjustments, when ending blocks with difficulty
-	BlockTime  float64     // Used when ending blocks with time (uniform blocks)
-	Timed      bool        // True if using timed blocks, false using difficulty
-	Seed       uint64      // Seed for all the miners
-	LX         *pow.LxrPow // The Proof of work function to be used.
+	Index      uint64         // Index of this mining instance
+	TokenURL   string         // URL for rewards
+	Instances  int            // How many hashers to run
+	MinerCnt   int            // Number of miners to run
+	Loop       int            // How many times we loop over a hash computing PoW
+	Bits       int            // Number of bits in the size of the ByteMap (30 == 1GB ByteMap)
+	Passes     int            // Number of shuffles of the ByteMap
+	AlgVersion int            // Version of LxrPoW (the ByteMap generator) to mine with
+	Mmap       bool           // Memory map the ByteMap so processes on a host share it
+	Phrase     string         // A phrase used to create the seed nonce for mining
+	Randomize  bool           // Use an OS generated random number to avoid seed collisions
+	Difficulty uint64         // The difficulty limit (if using difficulty to end mining blocks)
+	Pow256     bool           // Rank submissions and end blocks on the 256 bit PoW
+	Limit      pow.Difficulty // Least PoW hashers report to their miner
+	DiffWindow int            // Determines Difficulty adjustments, when ending blocks with difficulty
+	BlockTime  float64        // Used when ending blocks with time (uniform blocks)
+	Timed      bool           // True if using timed blocks, false using difficulty
+	Seed       uint64         // Seed for all the miners
+	Nonces     string         // How hashers pick nonces: partitioned or legacy
+	LX         *pow.LxrPow    // The Proof of work function to be used.
+	Manager    *pow.Manager   // Builds the Proof of work functions of new Settings
+	LogLevel   string         // Level of logging (debug, info, warn, error)
+	Logger     *slog.Logger   // Logger shared by the miners, hashers and validators
+
+	Policy     hashing.SolutionPolicy    // What hashers do with solutions while the miner is busy
+	BestN      int                       // Solutions buffered under the bestn policy
+	Duplicates *hashing.DuplicateSampler // Counts nonces searched twice by any of the miners sharing it
+}
+
+// Ways the hashers of a miner pick their nonces
+const (
+	NoncesPartitioned = "partitioned" // Each miner and instance counts through its own range
+	NoncesLegacy      = "legacy"      // Each instance walks from the seed, and may repeat the work of others
+)
+
+// LegacyNonces reports if the hashers walk from the seed rather than count through
+// partitioned ranges
+func (c *Config) LegacyNonces() bool {
+	return c.Nonces == NoncesLegacy
+}
+
+// NonceMiner
+// Returns the miner whose nonces the given miner registered in this process
+// searches.  The Index is folded in, so processes with distinct indexes never
+// search the same nonces.
+func (c *Config) NonceMiner(local uint64) (uint64, error) {
+	return hashing.PartitionMiner(c.Index, local)
 }
 
 // Return a shallow copy of the configuration settings.
@@ -53,20 +89,39 @@ func (c *Config) RandomizeSeed() {
 // Init
 // What
 func (c *Config) Init() {
+	c.InitContext(context.Background())
+}
+
+// InitContext
+// Init, giving up on loading or generating the ByteMap when the context is done,
+// so the miner can be interrupted while it starts
+func (c *Config) InitContext(ctx context.Context) {
 	args := os.Args
 	_ = args
-	pIndex := flag.Uint64("index", 1, "Index of the miner, where many miners may work together")
+	pIndex := flag.Uint64("index", 1, "Index of the miner, where many miners may work together; give each process its own so their nonces never overlap")
 	pTokenURL := flag.String("tokenurl", "RedWagon.acme/tokens", "URL for where rewards go, and identify the ADI")
 	pInstances := flag.Int("instances", 1, "Number of instances of the hash miners")
 	pMinerCnt := flag.Int("minercnt", 1, "Number of miners (with random URLs) to run")
 	pLoop := flag.Int("loop", 50, "Number of loops accessing ByteMap (more is slower)")
 	pBits := flag.Int("bits", 30, "Number of bits addressing the ByteMap (more is bigger)")
+	pPasses := flag.Int("passes", 6, "Number of shuffles of the ByteMap")
+	pAlgVersion := flag.Int("algversion", int(pow.GeneratorLegacy), "LxrPoW version: 1 original ByteMap generator, 2 parallel generator")
+	pMmap := flag.Bool("mmap", false, "memory map the ByteMap so miners and validators on a host share one copy")
 	pPhrase := flag.String("phrase", "", "private phrase hashed to ensure unique nonces for the miner")
+	pNonces := flag.String("nonces", NoncesPartitioned, "how hashers pick nonces: partitioned gives each miner and instance its own range, legacy walks from the seed")
+	pPolicy := hashing.PolicyBlock
+	flag.Var(&pPolicy, "solutions", "what hashers do with solutions while the miner is busy: block, droplower (keep the higher PoW) or bestn (buffer the best of the block)")
+	pBestN := flag.Int("bestn", hashing.DefaultBestN, "solutions of a block buffered with --solutions=bestn")
 	pRandomize := flag.Bool("randomize", true, "randomize seed to lesson chances of collision with other miners")
-	pDifficulty := flag.Uint64("difficulty", 0xffff<<48, "Difficulty target (timed) or difficulty termination (not timed)")
+	pDifficulty := pow.Difficulty(0xffff << 48)
+	flag.Var(&pDifficulty, "difficulty", "Difficulty target (timed) or difficulty termination (not timed); hex, decimal, or leading bits like 16bits")
+	pLimit := pow.DifficultyFromBits(12)
+	flag.Var(&pLimit, "limit", "Least PoW hashers report to their miner; hex, decimal, or leading bits like 12bits")
+	pPow256 := flag.Bool("pow256", false, "rank submissions and end blocks on the 256 bit PoW, so submissions rarely tie")
 	pDiffWindow := flag.Int("diffwindow", 1000, "Difficulty Target Valuation in blocks")
 	pBlockTime := flag.Float64("blocktime", 600, "Block Time in seconds (600 would be 10 minutes)")
 	pTimed := flag.Bool("timed", false, "Blocks are timed, or blocks end with a given difficulty")
+	pLogLevel := flag.String("loglevel", "info", "Level of logging: debug, info, warn or error")
 	flag.Parse()
 
 	c.Index = *pIndex
@@ -75,12 +130,21 @@ func (c *Config) Init() {
 	c.MinerCnt = *pMinerCnt
 	c.Loop = *pLoop
 	c.Bits = *pBits
+	c.Passes = *pPasses
+	c.AlgVersion = *pAlgVersion
+	c.Mmap = *pMmap
 	c.Phrase = *pPhrase
+	c.Nonces = *pNonces
+	c.Policy = pPolicy
+	c.BestN = *pBestN
 	c.Randomize = *pRandomize
-	c.Difficulty = *pDifficulty
+	c.Difficulty = uint64(pDifficulty)
+	c.Limit = pLimit
+	c.Pow256 = *pPow256
 	c.DiffWindow = *pDiffWindow
 	c.BlockTime = *pBlockTime
 	c.Timed = *pTimed
+	c.LogLevel = *pLogLevel
 
 	h := sha256.Sum256([]byte(c.Phrase))
 
@@ -94,10 +158,10 @@ func (c *Config) Init() {
 		c.MinerCnt = 1
 	}
 
-	fmt.Printf("\nminer --index=%d --tokenurl=\"%s\" --instances=%d --minercnt=%d --loop=%d --bits=%d --phrase=\"%s\""+
-		" --randomize=%v --difficulty=0x%x --diffwindow=%d --blocktime=%f --timed=%v\n\n",
-		c.Index, c.TokenURL, c.Instances, c.MinerCnt, c.Loop, c.Bits, c.Phrase,
-		c.Randomize, c.Difficulty, c.DiffWindow, c.BlockTime, c.Timed,
+	fmt.Printf("\nminer --index=%d --tokenurl=\"%s\" --instances=%d --minercnt=%d --loop=%d --bits=%d --passes=%d --algversion=%d --mmap=%v --phrase=\"%s\""+
+		" --nonces=%s --solutions=%v --bestn=%d --randomize=%v --difficulty=0x%x --limit=%v --pow256=%v --diffwindow=%d --blocktime=%f --timed=%v --loglevel=%s\n\n",
+		c.Index, c.TokenURL, c.Instances, c.MinerCnt, c.Loop, c.Bits, c.Passes, c.AlgVersion, c.Mmap, c.Phrase,
+		c.Nonces, c.Policy, c.BestN, c.Randomize, c.Difficulty, c.Limit, c.Pow256, c.DiffWindow, c.BlockTime, c.Timed, c.LogLevel,
 	)
 	fmt.Printf("Filename: out-instances%d-minercnt%d-loop%d-difficulty0x%x-diffwindow%d-blocktime%f-timed_%v.txt\n\n",
 		c.Instances, c.MinerCnt, c.Loop, c.Difficulty, c.DiffWindow, c.BlockTime, c.Timed)
@@ -106,26 +170,65 @@ func (c *Config) Init() {
 		os.Exit(1)
 	}
 
-	c.LX = pow.NewLxrPow(c.Loop, c.Bits, 6)
-	accumulate.MiningADI.LX = c.LX
+	var level slog.Level
+	level.UnmarshalText([]byte(c.LogLevel)) // ConfigIsValid has checked the level
+	c.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	c.Duplicates = hashing.NewDuplicateSampler() // Clones share it, so repeats across miners are counted
+
 	// for purposes of testing, we will assert settings given on the command line.
 	settings := accumulate.MiningADI.Sync()
 	settings.Bits = uint16(c.Bits)
 	settings.Loops = uint16(c.Loop)
+	settings.Passes = uint16(c.Passes)
+	settings.AlgorithmID = uint16(pow.AlgorithmLxrPoW)
+	settings.AlgorithmVersion = uint16(c.AlgVersion)
 	settings.TimeStamp = time.Now()
 	settings.BlockTime = uint16(c.BlockTime)
 	settings.Difficulty = c.Difficulty
+	if c.Pow256 {
+		settings.Difficulty256 = pow.Pow256FromUint64(c.Difficulty)
+	}
 	settings.DiffWindow = uint16(c.DiffWindow)
 	settings.TimeStamp = time.Now()
 	settings.WindowTimestamp = time.Now()
 	settings.WindowBlockIndex = 1
-	accumulate.MiningADI.Settings = append(accumulate.MiningADI.Settings, settings)
 
+	key := settings.AlgorithmKey()
+	lastPercent := -1
+	opts := pow.Options{Mmap: c.Mmap, Logger: c.Logger,
+		Progress: func(p pow.Progress) {
+			if percent := int(p.Percent()) / 10 * 10; percent != lastPercent { // Log every 10%
+				lastPercent = percent
+				c.Logger.Info("generating ByteMap table", "pass", p.Pass, "passes", p.Passes, "percent", percent)
+			}
+		}}
+	c.Manager = pow.NewManager(opts) // Settings may change the Proof of work function later
+	opts.Loops, opts.Bits, opts.Passes, opts.Generator = key.Loops, key.Bits, key.Passes, pow.GeneratorVersion(key.Version)
+	lx, err := pow.NewContext(ctx, opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			c.Logger.Info("interrupted while creating the proof of work function", "algorithm", key)
+			os.Exit(1)
+		}
+		c.Logger.Error("could not create the proof of work function", "error", err, "algorithm", key)
+		os.Exit(1)
+	}
+	c.LX = lx
+	c.Manager.Add(lx)
+	accumulate.MiningADI.LX = c.LX
+	accumulate.MiningADI.Manager = c.Manager
+	accumulate.MiningADI.Settings = append(accumulate.MiningADI.Settings, settings)
 }
 
 func NewConfig() *Config {
+	return NewConfigContext(context.Background())
+}
+
+// NewConfigContext
+// NewConfig, giving up on loading or generating the ByteMap when the context is done
+func NewConfigContext(ctx context.Context) *Config {
 	c := new(Config)
-	c.Init()
+	c.InitContext(ctx)
 	return c
 }
 
@@ -144,6 +247,23 @@ func ConfigIsValid(cfg *Config) bool {
 		fmt.Println("token url provided is not a valid url")
 		success = false
 	}
+	if cfg.Passes < 0 || cfg.Passes > math.MaxUint16 {
+		fmt.Printf("passes %d is out of range\n", cfg.Passes)
+		success = false
+	}
+	if _, err := pow.LookupGenerator(pow.GeneratorVersion(cfg.AlgVersion)); err != nil || cfg.AlgVersion > math.MaxUint16 {
+		fmt.Printf("LxrPoW version %d is unknown\n", cfg.AlgVersion)
+		success = false
+	}
+	if cfg.Nonces != NoncesPartitioned && cfg.Nonces != NoncesLegacy {
+		fmt.Printf("nonces %q is not one of %s or %s\n", cfg.Nonces, NoncesPartitioned, NoncesLegacy)
+		success = false
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		fmt.Printf("log level %q is not one of debug, info, warn or error\n", cfg.LogLevel)
+		success = false
+	}
 	// Add other tests like query the protocol that the token account actually exists
 	return success
 }
@@ -0,0 +1,48 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package cfg
+
+import (
+	"testing"
+
+	"github.com/pegnet/LXRPow/hashing"
+)
+
+// Miners are numbered from 0 in every process, so only the Index keeps the nonces
+// of two processes apart
+func TestNonceMiner(t *testing.T) {
+	c1, c2 := &Config{Index: 1}, &Config{Index: 2}
+	for local := uint64(0); local < 4; local++ {
+		m1, err := c1.NonceMiner(local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m2, err := c2.NonceMiner(local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h1, h2 := hashing.NewHashers(2, 1, nil), hashing.NewHashers(2, 1, nil)
+		if err := h1.UsePartitionedNonces(m1); err != nil {
+			t.Fatal(err)
+		}
+		if err := h2.UsePartitionedNonces(m2); err != nil {
+			t.Fatal(err)
+		}
+		// A range is fixed by the bits above the counter, so ranges that differ
+		// there are disjoint
+		ranges := make(map[uint64]uint64)
+		for _, i := range h1.Instances {
+			ranges[i.Nonces.Next()>>hashing.CounterBits] = c1.Index
+		}
+		for _, i := range h2.Instances {
+			r := i.Nonces.Next() >> hashing.CounterBits
+			if index, ok := ranges[r]; ok {
+				t.Fatalf("miner %d of index %d searches the range of index %d", local, c2.Index, index)
+			}
+		}
+	}
+
+	if _, err := (&Config{Index: 1 << hashing.ProcessBits}).NonceMiner(0); err == nil {
+		t.Error("expected an error for an index out of range")
+	}
+}
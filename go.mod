@@ -1,5 +1,5 @@
 module github.com/pegnet/LXRPow
 
-go 1.20
+go 1.21
 
 require github.com/dustin/go-humanize v1.0.1
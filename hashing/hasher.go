@@ -3,11 +3,18 @@
 package hashing
 
 import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pegnet/LXRPow/pow"
 )
 
+// ErrRunning is returned by Run if the Hasher or HasherSet is already running
+var ErrRunning = errors.New("already running")
+
 type PoWSolution struct {
 	Block    uint64    // Block Number
 	TokenURL string    // Payout token account
@@ -17,21 +24,34 @@ type PoWSolution struct {
 	Nonce    uint64    // Nonce that is the solution
 	Pow      uint64    // Self-reported Difficulty
 	HashCnt  uint64    // Count of hashes performed so far
+	JobID    uint64    // The job the solution was found for
 }
 
 // All that is needed to create a Hasher instance.  Once it is created,
 // It will run and feed back solutions
 type Hasher struct {
 	Instance    int
-	CurrentHash [32]byte
-	Nonce       uint64
+	CurrentHash [32]byte // Hash being worked on; only read it while the Hasher is not running
+	Nonce       uint64   // Last nonce tried; only read it while the Hasher is not running
 	BlockHashes chan Hash
 	Solutions   chan PoWSolution
-	Control     chan string
 	Best        uint64
-	Started     bool
-	HashCnt     uint64
 	LX          *pow.LxrPow
+	Work        WorkSource        // Jobs to work on; if nil, the hashes sent on BlockHashes
+	Nonces      NonceSource       // Nonces to try; if nil, LegacyNonces seeded with Nonce are used
+	Duplicates  *DuplicateSampler // Records sampled nonces to count repeated work; may be nil
+	Policy      SolutionPolicy    // What to do with solutions when Solutions is not being read
+	Buffer      *SolutionBuffer   // Buffers solutions under PolicyBestN
+
+	hashCnt   atomic.Uint64   // Count of hashes performed so far
+	solutions atomic.Uint64   // Count of solutions found
+	dropped   atomic.Uint64   // Count of solutions dropped by the policy
+	started   atomic.Bool     // True while Run is hashing
+	mutex     sync.Mutex      // Protects cancel and running
+	cancel    func()          // Stops the Run started by Start
+	running   *sync.WaitGroup // Done when the Run started by Start returns
+	bestMutex sync.Mutex      // Protects bests
+	bests     []BlockBest     // Best PoW of recent blocks, oldest first
 }
 
 func NewHasher(instance int, nonce uint64, lx *pow.LxrPow) *Hasher {
@@ -41,7 +61,6 @@ func NewHasher(instance int, nonce uint64, lx *pow.LxrPow) *Hasher {
 	m.LX = lx
 
 	// Inputs to the Hasher
-	m.Control = make(chan string, 1)   // The Hasher stops when told on this channel
 	m.BlockHashes = make(chan Hash, 1) // Hashes to Hash are read from this channel
 
 	// Outputs from the Hasher (can be overwritten and thus shared across Hashers)
@@ -50,45 +69,141 @@ func NewHasher(instance int, nonce uint64, lx *pow.LxrPow) *Hasher {
 	return m
 }
 
-func (m *Hasher) Stop() {
-	if !m.Started {
+// HashCount returns the count of hashes performed so far.  It is safe to call
+// while the Hasher is running.
+func (m *Hasher) HashCount() uint64 {
+	return m.hashCnt.Load()
+}
+
+// Started reports if the Hasher is running
+func (m *Hasher) Started() bool {
+	return m.started.Load()
+}
+
+// Start runs the Hasher in a goroutine until Stop is called.  It does nothing
+// if the Hasher was already started.
+func (m *Hasher) Start() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.cancel != nil {
 		return
 	}
-	m.Control <- "stop"
-	m.Started = false
+	ctx, cancel := context.WithCancel(context.Background())
+	running := new(sync.WaitGroup)
+	m.cancel, m.running = cancel, running
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		m.Run(ctx)
+	}()
 }
 
-func (m *Hasher) Start() {
-	if m.Started {
+// Stop stops the Hasher started by Start, and returns once it has stopped hashing
+func (m *Hasher) Stop() {
+	m.mutex.Lock()
+	cancel, running := m.cancel, m.running
+	m.cancel, m.running = nil, nil
+	m.mutex.Unlock()
+	if cancel == nil {
 		return
 	}
+	cancel()
+	running.Wait()
+}
+
+// Run
+// Works on the jobs of Work until the context is done, writing every solution over
+// the limit of its job to Solutions as the Policy says.  Without a Work source, the
+// hashes sent on BlockHashes are the jobs.  It waits for the first job before
+// hashing, and moves to a newer job as soon as there is one.  An expired job, or
+// one whose nonce range is searched, is left for the next.  Run returns the
+// context's error, or ErrRunning if the Hasher is already running.
+func (m *Hasher) Run(ctx context.Context) error {
+	if !m.started.CompareAndSwap(false, true) {
+		return ErrRunning
+	}
+	defer m.started.Store(false)
 
-	m.Started = true
-	go func() {
-		var limit uint64
+	work := m.Work
+	if work == nil {
+		hashes := NewHashSource()
+		feedCtx, cancel := context.WithCancel(ctx)
+		var feeding sync.WaitGroup
+		feeding.Add(1)
+		go func() {
+			defer feeding.Done()
+			hashes.Feed(feedCtx, m.BlockHashes)
+		}()
+		defer feeding.Wait() // so no hash sent for a later Run is taken
+		defer cancel()
+		work = hashes
+	}
 
-		hash := <-m.BlockHashes
+	nonces := m.Nonces
+	if nonces == nil {
+		nonces = &LegacyNonces{Nonce: m.Nonce, Count: m.hashCnt.Load()}
+	}
+
+	var job Job
+	var jobHashes, best uint64
+	var alg pow.Algorithm
+	defer func() { job.Lease.Release() }()
+	next := func() error { // Waits for a newer job that has not expired
 		for {
-			
-			select {
-			case hash = <-m.BlockHashes:
-				m.CurrentHash = hash.Hash
-				limit = hash.Limit
-				continue // Read Hashes until the channel is empty
-			case cmd := <-m.Control:
-				if cmd == "stop" {
-					return
-				}
-			default:
+			j, err := work.Next(ctx, m.Instance, job.ID)
+			if err != nil {
+				return err
 			}
-			m.HashCnt++
-			m.Nonce ^= m.Nonce<<17 ^ m.Nonce>>9 ^ m.HashCnt // diff nonce for each instance
-			nPow := m.LX.LxrPoW(hash.Hash[:], m.Nonce)
-			if nPow > limit {
-				m.Solutions <- PoWSolution{
-					m.HashCnt, "", int16(m.Instance), time.Now(), hash.Hash, m.Nonce, nPow, m.HashCnt,
-				}
+			job.Lease.Release() // Done with the algorithm of the last job
+			job = j
+			if !job.Expired(time.Now()) {
+				break
 			}
 		}
-	}()
+		m.CurrentHash, alg, jobHashes, best = job.Hash, job.Alg, 0, 0
+		if alg == nil {
+			alg = m.LX
+		}
+		return nil
+	}
+
+	if err := next(); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if work.Latest() != job.ID || job.Expired(time.Now()) ||
+			!job.Nonces.Empty() && jobHashes >= job.Nonces.End-job.Nonces.Start {
+			if err := next(); err != nil {
+				return err
+			}
+			continue
+		}
+		hashCnt := m.hashCnt.Add(1)
+		if job.Nonces.Empty() {
+			m.Nonce = nonces.Next()
+		} else {
+			m.Nonce = job.Nonces.Start + jobHashes
+		}
+		jobHashes++
+		if m.Duplicates != nil && Sampled(m.Nonce) {
+			m.Duplicates.Observe(job.Hash, m.Nonce)
+		}
+		nPow, ok := alg.Meets(job.Hash[:], m.Nonce, job.Limit)
+		if nPow > best {
+			best = nPow
+			m.recordBest(job.Block, job.Hash, best)
+		}
+		if ok {
+			if err := m.emit(ctx, PoWSolution{
+				job.Block, "", int16(m.Instance), time.Now(), job.Hash, m.Nonce, nPow, hashCnt, job.ID,
+			}); err != nil {
+				return err
+			}
+		}
+	}
 }
@@ -3,15 +3,23 @@
 package hashing
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pegnet/LXRPow/pow"
 )
 
 type Hash struct {
-	Hash  [32]byte // The Hash to work on
-	Limit uint64   // Solutions must be over the given limit
+	Hash   [32]byte      // The Hash to work on
+	Block  uint64        // Block number of the hash, reported with solutions and best PoWs
+	Limit  uint64        // Solutions must be over the given limit
+	Alg    pow.Algorithm // Algorithm to hash with; if nil, the LxrPow of the hasher is used
+	Lease  *pow.Lease    // Keeps Alg from being closed while hashers use it; may be nil
+	Expiry time.Time     // Hashers stop working on the hash after; zero never expires
 }
 
 // All that is needed to create a Hasher instance.  Once it is created,
@@ -20,10 +28,24 @@ type HasherSet struct {
 	Instances   []*Hasher
 	BlockHashes chan Hash
 	Solutions   chan PoWSolution
-	Control     chan string
 	Nonce       uint64
 	Lx          *pow.LxrPow
-	Started     bool
+	Logger      *slog.Logger      // Defaults to logging nothing
+	Duplicates  *DuplicateSampler // Shared by every Hasher to count repeated work
+	Policy      SolutionPolicy    // Policy of every Hasher; set it with SetSolutionPolicy
+	Work        WorkSource        // Jobs of every Hasher; set it with SetWork
+
+	started atomic.Bool     // True while Run is hashing
+	mutex   sync.Mutex      // Protects cancel and running
+	cancel  func()          // Stops the Run started by Start
+	running *sync.WaitGroup // Done when the Run started by Start returns
+	buffer  *SolutionBuffer // Shared by every Hasher under PolicyBestN
+
+	statsMutex    sync.Mutex // Protects the hash rates
+	rates         [3]float64 // Hash rates over rateWindows
+	rated         bool       // True once a rate has been measured
+	sampled       time.Time  // When the hash count was last sampled
+	sampledHashes uint64     // Hash count when last sampled
 }
 
 // NewHashers
@@ -36,25 +58,28 @@ func NewHashers(Instances int, Nonce uint64, Lx *pow.LxrPow) *HasherSet {
 	h.Lx = Lx
 	h.BlockHashes = make(chan Hash, 10)
 	h.Solutions = make(chan PoWSolution, 10)
-	h.Control = make(chan string, 10)
+	h.Logger = pow.DiscardLogger()
+	h.Duplicates = NewDuplicateSampler()
+	h.Work = NewHashSource() // Hashes sent on BlockHashes become the jobs
 
 	for i := 0; i < Instances; i++ {
 		n := h.Nonce ^ uint64(i)
 		n = n<<19 ^ n>>11
 
 		instance := NewHasher(i, n, Lx)
-		instance.Solutions = h.Solutions // override Solutions channel
+		instance.Solutions = h.Solutions   // override Solutions channel
+		instance.Duplicates = h.Duplicates // share the duplicate counts
+		instance.Work = h.Work             // pull jobs from the set
 
 		h.Instances = append(h.Instances, instance) // Collect all our instances
-
-		instance.Start()
 	}
 
 	return h
 }
 
 // SetSolutions
-// Direct solutions to the given solutions channel
+// Direct solutions to the given solutions channel.  It must not be called while
+// the HasherSet is running.
 func (h *HasherSet) SetSolutions(solutions chan PoWSolution) {
 	h.Solutions = solutions
 	for _, hasher := range h.Instances {
@@ -62,41 +87,103 @@ func (h *HasherSet) SetSolutions(solutions chan PoWSolution) {
 	}
 }
 
-func (h *HasherSet) Stop() {
-	if !h.Started {
-		return
-	}
-	h.Control <- "stop"
-	h.Started = false
-	fmt.Println("\nStopping All Hashers")
-	for _, i := range h.Instances {
-		i.Stop()
+// SetDuplicates
+// Record sampled nonces in the given DuplicateSampler, so repeated work across
+// HasherSets sharing it is counted.  It must not be called while the HasherSet is
+// running.
+func (h *HasherSet) SetDuplicates(duplicates *DuplicateSampler) {
+	h.Duplicates = duplicates
+	for _, hasher := range h.Instances {
+		hasher.Duplicates = duplicates
 	}
 }
 
+// Started reports if the HasherSet is running
+func (h *HasherSet) Started() bool {
+	return h.started.Load()
+}
+
+// Start runs the HasherSet in a goroutine until Stop is called.  It does nothing
+// if the HasherSet was already started.
 func (h *HasherSet) Start() {
-	if h.Started {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.cancel != nil {
 		return
 	}
-	h.Started = true
-
+	ctx, cancel := context.WithCancel(context.Background())
+	running := new(sync.WaitGroup)
+	h.cancel, h.running = cancel, running
+	running.Add(1)
 	go func() {
-		for {
-			select {
-			case hash := <-h.BlockHashes:
-				for _, i := range h.Instances {
-					for !i.Started && len(i.BlockHashes) > 0 {
-						<-i.BlockHashes
-					}
-					i.BlockHashes <- hash
-				}
-			case cmd := <-h.Control:
-				if cmd == "stop" {
-					return
-				}
-			default:
-				time.Sleep(time.Second/4)
+		defer running.Done()
+		h.Run(ctx)
+	}()
+}
+
+// Stop stops the HasherSet started by Start, and returns once every Hasher has
+// stopped hashing
+func (h *HasherSet) Stop() {
+	h.mutex.Lock()
+	cancel, running := h.cancel, h.running
+	h.cancel, h.running = nil, nil
+	h.mutex.Unlock()
+	if cancel == nil {
+		return
+	}
+	h.Logger.Info("stopping all hashers", "instances", len(h.Instances))
+	cancel()
+	running.Wait()
+}
+
+// Run
+// Runs every Hasher until the context is done.  If Work is a HashSource, each hash
+// sent on BlockHashes is set as its newest job.  Run returns the context's error
+// once every Hasher has stopped, or ErrRunning if the HasherSet is already running.
+func (h *HasherSet) Run(ctx context.Context) error {
+	if !h.started.CompareAndSwap(false, true) {
+		return ErrRunning
+	}
+	defer h.started.Store(false)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, i := range h.Instances {
+		wg.Add(1)
+		go func(i *Hasher) {
+			defer wg.Done()
+			if err := i.Run(ctx); errors.Is(err, ErrRunning) {
+				h.Logger.Warn("hasher is already running", "instance", i.Instance)
 			}
+		}(i)
+	}
+	if h.buffer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.buffer.Forward(ctx, h.Solutions)
+		}()
+	}
+
+	h.statsMutex.Lock()
+	h.sampled = time.Time{} // Time stopped does not count against the hash rates
+	h.statsMutex.Unlock()
+	h.sample(time.Now())
+	source, ok := h.Work.(*HashSource)
+	hashes := h.BlockHashes
+	if !ok {
+		hashes = nil // Hashes have nowhere to go
+	}
+	ticker := time.NewTicker(StatsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			h.sample(now)
+		case hash := <-hashes:
+			source.Set(hash)
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-	}()
+	}
 }
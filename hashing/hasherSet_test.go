@@ -3,8 +3,12 @@
 package hashing
 
 import (
+	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"runtime"
+	"sync"
 	"testing"
 	"time"
 
@@ -27,7 +31,7 @@ func Test_HasherSet(t *testing.T) {
 		if s.Pow > best.Pow || s.Pow > 0xffff000000000000 {
 			var th uint64
 			for _, v := range m.Instances {
-				th += v.HashCnt
+				th += v.HashCount()
 			}
 			if best.Pow == 0 {
 				fmt.Println()
@@ -46,3 +50,89 @@ func Test_HasherSet(t *testing.T) {
 	m.Stop()
 	time.Sleep(time.Second)
 }
+
+func BenchmarkHasherSet(b *testing.B) {
+	lx, err := pow.New(pow.Options{Loops: 16, Bits: 20, Passes: 6, Store: pow.NewMemStore()})
+	if err != nil {
+		b.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte("benchmark"))
+	for instances := 1; instances <= runtime.NumCPU(); instances *= 2 {
+		b.Run(fmt.Sprintf("instances=%d", instances), func(b *testing.B) {
+			m := NewHashers(instances, 523452345, lx)
+			m.Start()
+			b.ResetTimer()
+			m.BlockHashes <- Hash{Hash: hash, Limit: ^uint64(0)}
+			for {
+				var th uint64
+				for _, v := range m.Instances {
+					th += v.HashCount()
+				}
+				if th >= uint64(b.N) {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			b.StopTimer()
+			m.Stop()
+		})
+	}
+}
+
+func Test_HasherSetRun(t *testing.T) {
+	lx, err := pow.New(pow.Options{Loops: 8, Bits: 8, Passes: 6, Store: pow.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	m := NewHashers(3, 523452345, lx)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+
+	// Every hasher gets the hash, and solutions come from all of them
+	hash := sha256.Sum256([]byte{1, 2, 3, 4})
+	m.BlockHashes <- Hash{Hash: hash, Limit: 0xF000000000000000}
+	seen := map[int16]bool{}
+	for len(seen) < len(m.Instances) {
+		s := <-m.Solutions
+		if s.DNHash != hash || !lx.Verify(s.DNHash[:], s.Nonce, s.Pow) {
+			t.Fatalf("bad solution %+v", s)
+		}
+		seen[s.Instance] = true
+	}
+	if !m.Started() {
+		t.Error("not started while running")
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	for _, h := range m.Instances {
+		if h.Started() {
+			t.Errorf("hasher %d still running after Run returned", h.Instance)
+		}
+	}
+
+	// Start and Stop from several goroutines at once
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Start()
+			m.BlockHashes <- Hash{Hash: hash, Limit: 0}
+			m.Stop()
+		}()
+	}
+	wg.Wait()
+	if m.Started() {
+		t.Error("still started after Stop")
+	}
+	for _, h := range m.Instances {
+		if h.Started() {
+			t.Errorf("hasher %d still running after Stop", h.Instance)
+		}
+	}
+}
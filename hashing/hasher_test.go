@@ -1,7 +1,9 @@
 package hashing_test
 
 import (
+	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -31,3 +33,131 @@ func Test_Hasher(t *testing.T) {
 		}
 	}
 }
+
+func Test_HasherSwitchesAlgorithm(t *testing.T) {
+	store := pow.NewMemStore()
+	lx, err := pow.New(pow.Options{Loops: 8, Bits: 8, Passes: 6, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := pow.New(pow.Options{Loops: 8, Bits: 10, Passes: 6, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewHasher(1, 1000, lx)
+	m.Start()
+	defer m.Stop()
+
+	// Each solution must be the PoW of the algorithm sent with its hash
+	hash := sha256.Sum256([]byte{1, 2, 3, 4})
+	m.BlockHashes <- Hash{Hash: hash, Limit: 0xF000000000000000}
+	if s := <-m.Solutions; s.DNHash != hash || !lx.Verify(s.DNHash[:], s.Nonce, s.Pow) {
+		t.Fatalf("solution %016x is not the PoW of the first algorithm", s.Pow)
+	}
+	hash = sha256.Sum256(hash[:])
+	m.BlockHashes <- Hash{Hash: hash, Limit: 0xF000000000000000, Alg: next}
+	for i := 0; i < 20; i++ {
+		s := <-m.Solutions
+		if s.DNHash != hash {
+			continue // Solutions of the first hash may still be in the channel
+		}
+		if !next.Verify(s.DNHash[:], s.Nonce, s.Pow) {
+			t.Fatalf("solution %016x is not the PoW of the second algorithm", s.Pow)
+		}
+		if s.Pow <= 0xF000000000000000 {
+			t.Fatalf("solution %016x does not beat the limit", s.Pow)
+		}
+	}
+}
+
+func Test_HasherRun(t *testing.T) {
+	lx, err := pow.New(pow.Options{Loops: 8, Bits: 8, Passes: 6, Store: pow.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	m := NewHasher(1, 1000, lx)
+
+	// Run waits for a hash, and returns once cancelled even without one
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+	for !m.Started() {
+		time.Sleep(time.Millisecond)
+	}
+	if err := m.Run(ctx); !errors.Is(err, ErrRunning) {
+		t.Errorf("expected ErrRunning, got %v", err)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if m.Started() {
+		t.Error("still started after Run returned")
+	}
+
+	// Stop returns once hashing has stopped, even if no one reads the solutions
+	m.Start()
+	m.Start()
+	m.BlockHashes <- Hash{Hash: sha256.Sum256([]byte{1}), Limit: 0}
+	for m.HashCount() < 2 { // Solutions is full after one, so it blocks on the second
+		time.Sleep(time.Millisecond)
+	}
+	m.Stop()
+	m.Stop()
+	if m.Started() {
+		t.Error("still started after Stop")
+	}
+	count := m.HashCount()
+	time.Sleep(10 * time.Millisecond)
+	if m.HashCount() != count {
+		t.Error("still hashing after Stop")
+	}
+}
+
+func Test_HasherLeaseRetire(t *testing.T) {
+	manager := pow.NewManager(pow.Options{Store: pow.NewMemStore()})
+	defer manager.Close()
+	key := pow.AlgorithmKey{ID: pow.AlgorithmLxrPoW, Version: uint16(pow.GeneratorLegacy), Loops: 8, Bits: 10, Passes: 6}
+	lease, err := manager.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lx := lease.Alg.(*pow.LxrPow)
+	next, err := pow.New(pow.Options{Loops: 8, Bits: 8, Passes: 6, Store: pow.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Close()
+
+	m := NewHasher(1, 1000, next)
+	m.Solutions = make(chan PoWSolution, 1000)
+	jobs := NewHashSource()
+	m.Work = jobs
+	m.Start()
+	jobs.Set(Hash{Hash: sha256.Sum256([]byte{1}), Limit: 0xFFFFFFFFFFFFFFFF, Alg: lease.Alg, Lease: lease})
+	for m.HashCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The hasher keeps hashing with its own lease once the algorithm is retired
+	lease.Release()
+	if err := manager.Retire(nil); err != nil {
+		t.Fatal(err)
+	}
+	count := m.HashCount()
+	for m.HashCount() < count+1000 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Moving to the next job releases the last lease, which closes the algorithm
+	jobs.Set(Hash{Hash: sha256.Sum256([]byte{2}), Limit: 0xFFFFFFFFFFFFFFFF, Alg: next})
+	count = m.HashCount()
+	for m.HashCount() < count+1000 {
+		time.Sleep(time.Millisecond)
+	}
+	m.Stop()
+	if lx.ByteMap != nil {
+		t.Error("retired algorithm was not closed once the hasher moved off it")
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package hashing
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// NonceSource
+// Supplies the nonces a Hasher tries.  Each Hasher needs its own; Next is only
+// called from the goroutine hashing.
+type NonceSource interface {
+	Next() uint64
+}
+
+// LegacyNonces
+// The original xorshift walk through the nonces, seeded per instance.  Nothing
+// keeps the walks of two instances or two miners from meeting, so they can search
+// the same nonces.
+type LegacyNonces struct {
+	Nonce uint64 // The last nonce returned
+	Count uint64 // Nonces returned so far, which are mixed into the walk
+}
+
+func (l *LegacyNonces) Next() uint64 {
+	l.Count++
+	l.Nonce ^= l.Nonce<<17 ^ l.Nonce>>9 ^ l.Count // diff nonce for each instance
+	return l.Nonce
+}
+
+// Bits of the nonce used by PartitionedNonces.  The miner is in the top bits,
+// then the instance, then the counter.
+const (
+	MinerBits    = 20 // Up to 1,048,576 miners
+	InstanceBits = 8  // Up to 256 instances per miner
+	CounterBits  = 64 - MinerBits - InstanceBits
+)
+
+// Bits of the miner used by PartitionMiner.  The index of the mining process is in
+// the top bits, then the miner within the process.
+const (
+	LocalMinerBits = 8                          // Up to 256 miners registered in a process
+	ProcessBits    = MinerBits - LocalMinerBits // Up to 4096 processes
+)
+
+// PartitionMiner
+// Returns the miner whose nonces the given miner of the given process searches.
+// Miners are only numbered within a process, so two processes would search the
+// same ranges; with distinct process indexes, they never do.
+func PartitionMiner(process, local uint64) (uint64, error) {
+	if process >= 1<<ProcessBits {
+		return 0, fmt.Errorf("process %d does not fit in %d bits of the miner", process, ProcessBits)
+	}
+	if local >= 1<<LocalMinerBits {
+		return 0, fmt.Errorf("miner %d does not fit in %d bits of the miner", local, LocalMinerBits)
+	}
+	return process<<LocalMinerBits | local, nil
+}
+
+// PartitionedNonces
+// Counts through a range of nonces reserved for one instance of one miner.  Ranges
+// of different (miner, instance) pairs never overlap, so as long as miners have
+// distinct indexes, no nonce is searched twice.  Each range holds 2^36 nonces,
+// about 19 hours of hashing at a million hashes a second; after that the counter
+// wraps and the range is searched again.
+type PartitionedNonces struct {
+	prefix  uint64 // The miner and instance bits
+	counter uint64 // Nonces returned so far
+}
+
+// NewPartitionedNonces returns the nonces of the given instance of the given miner
+func NewPartitionedNonces(miner, instance uint64) (*PartitionedNonces, error) {
+	if miner >= 1<<MinerBits {
+		return nil, fmt.Errorf("miner %d does not fit in %d bits of the nonce", miner, MinerBits)
+	}
+	if instance >= 1<<InstanceBits {
+		return nil, fmt.Errorf("instance %d does not fit in %d bits of the nonce", instance, InstanceBits)
+	}
+	return &PartitionedNonces{prefix: miner<<(InstanceBits+CounterBits) | instance<<CounterBits}, nil
+}
+
+func (p *PartitionedNonces) Next() uint64 {
+	n := p.prefix | p.counter&(1<<CounterBits-1)
+	p.counter++
+	return n
+}
+
+// UsePartitionedNonces
+// Gives every Hasher of the set its own PartitionedNonces for the given miner.  If
+// any instance has no range, no Hasher is changed.  It must not be called while
+// the HasherSet is running.
+func (h *HasherSet) UsePartitionedNonces(miner uint64) error {
+	sources := make([]NonceSource, len(h.Instances))
+	for n, i := range h.Instances {
+		nonces, err := NewPartitionedNonces(miner, uint64(i.Instance))
+		if err != nil {
+			return err
+		}
+		sources[n] = nonces
+	}
+	for n, i := range h.Instances {
+		i.Nonces = sources[n]
+	}
+	return nil
+}
+
+// duplicateSampleBits sets the share of nonces the DuplicateSampler records, 1 in 2^12
+const duplicateSampleBits = 12
+
+// duplicateBlocks is how many recent hashes the DuplicateSampler remembers nonces for
+const duplicateBlocks = 2
+
+// DuplicateSampler
+// Estimates how much work is repeated, by recording a sample of the nonces tried
+// on each hash and counting those tried again.  Whether a nonce is sampled depends
+// only on the nonce, so a nonce repeated anywhere is sampled every time.  One
+// sampler can be shared by several HasherSets, such as miners in one process, to
+// detect repeats between them.
+type DuplicateSampler struct {
+	sampled    atomic.Uint64
+	duplicates atomic.Uint64
+	mutex      sync.Mutex                       // Protects seen and order
+	seen       map[[32]byte]map[uint64]struct{} // Sampled nonces of recent hashes
+	order      [][32]byte                       // Recent hashes, oldest first
+}
+
+// NewDuplicateSampler returns an empty DuplicateSampler
+func NewDuplicateSampler() *DuplicateSampler {
+	return &DuplicateSampler{seen: make(map[[32]byte]map[uint64]struct{})}
+}
+
+// Sampled reports if the nonce is one the sampler records.  It is cheap enough
+// to call for every hash.
+func Sampled(nonce uint64) bool {
+	return (nonce*0x9e3779b97f4a7c15)>>(64-duplicateSampleBits) == 0
+}
+
+// Observe records a sampled nonce tried on the hash, and reports if it had
+// already been tried
+func (d *DuplicateSampler) Observe(hash [32]byte, nonce uint64) (duplicate bool) {
+	d.sampled.Add(1)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	nonces, ok := d.seen[hash]
+	if !ok {
+		if len(d.order) == duplicateBlocks {
+			delete(d.seen, d.order[0])
+			d.order = d.order[1:]
+		}
+		nonces = make(map[uint64]struct{})
+		d.seen[hash] = nonces
+		d.order = append(d.order, hash)
+	}
+	if _, duplicate = nonces[nonce]; duplicate {
+		d.duplicates.Add(1)
+		return true
+	}
+	nonces[nonce] = struct{}{}
+	return false
+}
+
+// Counts returns the sampled nonces recorded, and how many of them were duplicates
+func (d *DuplicateSampler) Counts() (sampled, duplicates uint64) {
+	return d.sampled.Load(), d.duplicates.Load()
+}
@@ -0,0 +1,162 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package hashing
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/pegnet/LXRPow/pow"
+)
+
+func TestPartitionedNonces(t *testing.T) {
+	seen := make(map[uint64][2]uint64)
+	for _, miner := range []uint64{0, 1, 2, 1<<MinerBits - 1} {
+		for _, instance := range []uint64{0, 1, 1<<InstanceBits - 1} {
+			p, err := NewPartitionedNonces(miner, instance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 1000; i++ {
+				n := p.Next()
+				if other, ok := seen[n]; ok {
+					t.Fatalf("nonce %x of miner %d instance %d was also given to %v", n, miner, instance, other)
+				}
+				seen[n] = [2]uint64{miner, instance}
+				if n>>(InstanceBits+CounterBits) != miner || n>>CounterBits&(1<<InstanceBits-1) != instance {
+					t.Fatalf("nonce %x is outside the range of miner %d instance %d", n, miner, instance)
+				}
+			}
+		}
+	}
+
+	if _, err := NewPartitionedNonces(1<<MinerBits, 0); err == nil {
+		t.Error("expected an error for a miner out of range")
+	}
+	if _, err := NewPartitionedNonces(0, 1<<InstanceBits); err == nil {
+		t.Error("expected an error for an instance out of range")
+	}
+	h := NewHashers(1<<InstanceBits+1, 1, nil)
+	if err := h.UsePartitionedNonces(0); err == nil {
+		t.Error("expected an error for more instances than ranges")
+	}
+	for _, i := range h.Instances {
+		if i.Nonces != nil {
+			t.Fatal("nonces were changed by a failed UsePartitionedNonces")
+		}
+	}
+}
+
+func TestPartitionMiner(t *testing.T) {
+	seen := make(map[uint64][2]uint64)
+	for _, process := range []uint64{0, 1, 2, 1<<ProcessBits - 1} {
+		for _, local := range []uint64{0, 1, 1<<LocalMinerBits - 1} {
+			miner, err := PartitionMiner(process, local)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if other, ok := seen[miner]; ok {
+				t.Fatalf("miner %d of process %d is also miner %d of process %d", local, process, other[1], other[0])
+			}
+			seen[miner] = [2]uint64{process, local}
+			if _, err := NewPartitionedNonces(miner, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if _, err := PartitionMiner(1<<ProcessBits, 0); err == nil {
+		t.Error("expected an error for a process out of range")
+	}
+	if _, err := PartitionMiner(0, 1<<LocalMinerBits); err == nil {
+		t.Error("expected an error for a miner out of range")
+	}
+}
+
+// The legacy nonces are the walk the Hasher used before nonces could be chosen
+func TestLegacyNonces(t *testing.T) {
+	nonce, l := uint64(0x1234567890abcdef), &LegacyNonces{Nonce: 0x1234567890abcdef}
+	for hashCnt := uint64(1); hashCnt <= 1000; hashCnt++ {
+		nonce ^= nonce<<17 ^ nonce>>9 ^ hashCnt
+		if n := l.Next(); n != nonce {
+			t.Fatalf("nonce %d is %x, expected %x", hashCnt, n, nonce)
+		}
+	}
+}
+
+func TestDuplicateSampler(t *testing.T) {
+	d := NewDuplicateSampler()
+	hashes := [3][32]byte{{1}, {2}, {3}}
+	if d.Observe(hashes[0], 7) || d.Observe(hashes[1], 7) {
+		t.Error("a nonce tried on different hashes is not a duplicate")
+	}
+	if !d.Observe(hashes[0], 7) {
+		t.Error("a nonce tried twice on a hash is a duplicate")
+	}
+	d.Observe(hashes[2], 7) // Forgets the first hash
+	if d.Observe(hashes[0], 7) {
+		t.Error("the nonces of old hashes should be forgotten")
+	}
+	if sampled, duplicates := d.Counts(); sampled != 5 || duplicates != 1 {
+		t.Errorf("expected 5 sampled and 1 duplicate, got %d and %d", sampled, duplicates)
+	}
+
+	sampled := 0
+	for n := uint64(0); n < 1<<20; n++ {
+		if Sampled(n) {
+			sampled++
+		}
+	}
+	if want := 1 << (20 - duplicateSampleBits); sampled < want*9/10 || sampled > want*11/10 {
+		t.Errorf("%d of 2^20 nonces sampled, expected about %d", sampled, want)
+	}
+}
+
+// Two sets of hashers with the same seed repeat each other's work with legacy
+// nonces, and none with partitioned nonces
+func TestDuplicates(t *testing.T) {
+	lx, err := pow.New(pow.Options{Loops: 1, Bits: 8, Passes: 1, Store: pow.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+
+	hash := Hash{Hash: sha256.Sum256([]byte("duplicates")), Limit: 0xFFFFFFFFFFFFFFFF}
+	for _, partitioned := range []bool{false, true} {
+		d := NewDuplicateSampler()
+		var sets []*HasherSet
+		for miner := uint64(0); miner < 2; miner++ {
+			h := NewHashers(2, 1, lx)
+			h.SetDuplicates(d)
+			if partitioned {
+				if err := h.UsePartitionedNonces(miner); err != nil {
+					t.Fatal(err)
+				}
+			}
+			h.Start()
+			h.BlockHashes <- hash
+			sets = append(sets, h)
+		}
+		for {
+			if sampled, _ := d.Counts(); sampled >= 100 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		for _, h := range sets {
+			h.Stop()
+		}
+
+		s := sets[0].Stats()
+		if s.SampledNonces < 100 {
+			t.Fatalf("only %d nonces sampled", s.SampledNonces)
+		}
+		if partitioned && s.DuplicateNonces != 0 {
+			t.Errorf("%d duplicates with partitioned nonces", s.DuplicateNonces)
+		}
+		if !partitioned && s.DuplicateRate == 0 {
+			t.Errorf("no duplicates found with legacy nonces of the same seed: %+v", s)
+		}
+	}
+}
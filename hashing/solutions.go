@@ -0,0 +1,217 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package hashing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SolutionPolicy
+// What a Hasher does with a solution when nothing is reading Solutions.  Blocking
+// stalls the Hasher until the solution is read; the other policies keep it hashing
+// and drop solutions instead, counting them.
+type SolutionPolicy int
+
+const (
+	PolicyBlock     SolutionPolicy = iota // Wait until the solution is read
+	PolicyDropLower                       // Keep the higher PoW of the solution and one waiting in Solutions
+	PolicyBestN                           // Keep the best N solutions of the hash in a buffer feeding Solutions
+)
+
+// DefaultBestN is the size of the buffer of PolicyBestN when none is given
+const DefaultBestN = 16
+
+var policyNames = [...]string{"block", "droplower", "bestn"}
+
+func (p SolutionPolicy) String() string {
+	if p < 0 || int(p) >= len(policyNames) {
+		return fmt.Sprintf("SolutionPolicy(%d)", int(p))
+	}
+	return policyNames[p]
+}
+
+// ParseSolutionPolicy parses the name of a policy: block, droplower or bestn
+func ParseSolutionPolicy(s string) (SolutionPolicy, error) {
+	for p, name := range policyNames {
+		if strings.EqualFold(strings.TrimSpace(s), name) {
+			return SolutionPolicy(p), nil
+		}
+	}
+	return 0, fmt.Errorf("solution policy %q is not one of %s", s, strings.Join(policyNames[:], ", "))
+}
+
+// Set parses the policy with ParseSolutionPolicy, so a SolutionPolicy is a flag.Value
+func (p *SolutionPolicy) Set(s string) error {
+	v, err := ParseSolutionPolicy(s)
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+// SetSolutionPolicy
+// Sets the policy of every Hasher of the set.  PolicyBestN buffers the best n
+// solutions of the hash being mined, or DefaultBestN if n is not positive, and Run
+// feeds them to Solutions best first.  It must not be called while the HasherSet
+// is running.
+func (h *HasherSet) SetSolutionPolicy(policy SolutionPolicy, n int) {
+	h.Policy, h.buffer = policy, nil
+	if policy == PolicyBestN {
+		if n <= 0 {
+			n = DefaultBestN
+		}
+		h.buffer = NewSolutionBuffer(n)
+	}
+	for _, i := range h.Instances {
+		i.Policy, i.Buffer = policy, h.buffer
+	}
+}
+
+// emit
+// Writes a solution to Solutions as the policy of the Hasher says, returning the
+// context's error if it is done while waiting.  Without a Buffer, PolicyBestN
+// blocks.
+func (m *Hasher) emit(ctx context.Context, s PoWSolution) error {
+	m.solutions.Add(1)
+	switch {
+	case m.Policy == PolicyDropLower:
+		m.dropped.Add(dropLower(m.Solutions, s))
+	case m.Policy == PolicyBestN && m.Buffer != nil:
+		m.dropped.Add(m.Buffer.Push(s))
+	default:
+		select {
+		case m.Solutions <- s:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// dropLower
+// Writes the solution to Solutions without waiting.  If Solutions is full, a
+// waiting solution is taken out, and the better of the two is tried again; the
+// other is dropped.  Waiting solutions of another hash are older, so they always
+// lose.  Returns the count of solutions dropped.
+func dropLower(solutions chan PoWSolution, s PoWSolution) (dropped uint64) {
+	for {
+		select {
+		case solutions <- s:
+			return dropped
+		default:
+		}
+		select {
+		case waiting := <-solutions:
+			dropped++
+			if waiting.DNHash == s.DNHash && waiting.Pow >= s.Pow {
+				s = waiting
+			}
+		default: // Read meanwhile, so there is room now
+		}
+	}
+}
+
+// SolutionBuffer
+// A bounded buffer of the best solutions of the hash being mined, shared by the
+// Hashers of a set.  Pushing never waits; when the buffer is full the lowest PoW
+// is dropped.  Solutions of an older hash are dropped once one of a new hash is
+// pushed.
+type SolutionBuffer struct {
+	size  int
+	mutex sync.Mutex    // Protects best
+	best  []PoWSolution // Buffered solutions, best first
+	ready chan struct{} // Signalled when a solution is pushed
+}
+
+// NewSolutionBuffer returns a SolutionBuffer holding up to size solutions
+func NewSolutionBuffer(size int) *SolutionBuffer {
+	return &SolutionBuffer{size: max(size, 1), ready: make(chan struct{}, 1)}
+}
+
+// Push buffers the solution, and returns the count of solutions dropped
+func (b *SolutionBuffer) Push(s PoWSolution) (dropped uint64) {
+	b.mutex.Lock()
+	if len(b.best) > 0 && !sameHash(b.best[0], s) {
+		dropped += uint64(len(b.best))
+		b.best = b.best[:0]
+	}
+	dropped += b.insert(s)
+	b.mutex.Unlock()
+
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+// insert adds the solution in order of PoW, dropping the lowest if the buffer is
+// full.  It returns the count dropped, and must be called with the mutex held.
+func (b *SolutionBuffer) insert(s PoWSolution) (dropped uint64) {
+	i := sort.Search(len(b.best), func(i int) bool { return b.best[i].Pow < s.Pow })
+	b.best = append(b.best, PoWSolution{})
+	copy(b.best[i+1:], b.best[i:])
+	b.best[i] = s
+	if len(b.best) > b.size {
+		b.best = b.best[:b.size]
+		dropped++
+	}
+	return dropped
+}
+
+// sameHash reports if two solutions are for the same hash
+func sameHash(a, b PoWSolution) bool {
+	return a.DNHash == b.DNHash && a.Block == b.Block
+}
+
+// Len returns the count of solutions buffered
+func (b *SolutionBuffer) Len() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.best)
+}
+
+// pop removes and returns the best solution buffered, if any
+func (b *SolutionBuffer) pop() (s PoWSolution, ok bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if len(b.best) == 0 {
+		return s, false
+	}
+	s = b.best[0]
+	b.best = append(b.best[:0], b.best[1:]...)
+	return s, true
+}
+
+// Forward
+// Writes buffered solutions to solutions, best first, until the context is done.
+// A solution waiting to be read when the context is done is buffered again, unless
+// a solution of a newer hash has been pushed meanwhile.
+func (b *SolutionBuffer) Forward(ctx context.Context, solutions chan<- PoWSolution) error {
+	for {
+		s, ok := b.pop()
+		if !ok {
+			select {
+			case <-b.ready:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		select {
+		case solutions <- s:
+		case <-ctx.Done():
+			b.mutex.Lock()
+			if len(b.best) == 0 || sameHash(b.best[0], s) {
+				b.insert(s)
+			}
+			b.mutex.Unlock()
+			return ctx.Err()
+		}
+	}
+}
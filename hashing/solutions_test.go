@@ -0,0 +1,142 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package hashing
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/pegnet/LXRPow/pow"
+)
+
+func TestParseSolutionPolicy(t *testing.T) {
+	for _, p := range []SolutionPolicy{PolicyBlock, PolicyDropLower, PolicyBestN} {
+		if got, err := ParseSolutionPolicy(p.String()); err != nil || got != p {
+			t.Errorf("%v parsed as %v, %v", p, got, err)
+		}
+	}
+	if _, err := ParseSolutionPolicy("best"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestDropLower(t *testing.T) {
+	hash := [32]byte{1}
+	solutions := make(chan PoWSolution, 1)
+	if dropped := dropLower(solutions, PoWSolution{DNHash: hash, Pow: 5}); dropped != 0 {
+		t.Errorf("%d dropped with room in Solutions", dropped)
+	}
+	if dropped := dropLower(solutions, PoWSolution{DNHash: hash, Pow: 3}); dropped != 1 {
+		t.Errorf("expected 1 dropped, got %d", dropped)
+	}
+	if s := <-solutions; s.Pow != 5 {
+		t.Errorf("expected the higher PoW kept, got %d", s.Pow)
+	}
+
+	// The solution of a new hash replaces one of an older hash, even if lower
+	solutions <- PoWSolution{DNHash: hash, Pow: 9}
+	dropLower(solutions, PoWSolution{DNHash: [32]byte{2}, Pow: 1})
+	if s := <-solutions; s.DNHash != [32]byte{2} {
+		t.Errorf("expected the solution of the new hash kept, got %+v", s)
+	}
+}
+
+func TestSolutionBuffer(t *testing.T) {
+	b := NewSolutionBuffer(3)
+	hash := [32]byte{1}
+	var dropped uint64
+	for _, p := range []uint64{4, 1, 7, 5, 2} {
+		dropped += b.Push(PoWSolution{DNHash: hash, Block: 1, Pow: p})
+	}
+	if dropped != 2 || b.Len() != 3 {
+		t.Errorf("expected 3 buffered and 2 dropped, got %d and %d", b.Len(), dropped)
+	}
+	for _, want := range []uint64{7, 5, 4} {
+		if s, ok := b.pop(); !ok || s.Pow != want {
+			t.Errorf("expected PoW %d, got %d", want, s.Pow)
+		}
+	}
+
+	// A new block drops what is buffered for the old one
+	b.Push(PoWSolution{DNHash: hash, Block: 1, Pow: 8})
+	b.Push(PoWSolution{DNHash: hash, Block: 1, Pow: 9})
+	if dropped := b.Push(PoWSolution{DNHash: [32]byte{2}, Block: 2, Pow: 1}); dropped != 2 || b.Len() != 1 {
+		t.Errorf("expected 2 dropped for the new block, got %d with %d buffered", dropped, b.Len())
+	}
+
+	// Forward writes the best first
+	b.Push(PoWSolution{DNHash: [32]byte{2}, Block: 2, Pow: 3})
+	solutions := make(chan PoWSolution)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Forward(ctx, solutions) }()
+	if s := <-solutions; s.Pow != 3 {
+		t.Errorf("expected PoW 3 forwarded first, got %d", s.Pow)
+	}
+	if s := <-solutions; s.Pow != 1 {
+		t.Errorf("expected PoW 1 forwarded next, got %d", s.Pow)
+	}
+	b.Push(PoWSolution{DNHash: [32]byte{2}, Block: 2, Pow: 6})
+	if s := <-solutions; s.Pow != 6 {
+		t.Errorf("expected PoW 6 forwarded once pushed, got %d", s.Pow)
+	}
+
+	// A solution not read when Forward stops is kept
+	b.Push(PoWSolution{DNHash: [32]byte{2}, Block: 2, Pow: 2})
+	for b.Len() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	if b.Len() != 1 {
+		t.Errorf("the solution being forwarded was lost")
+	}
+}
+
+// With nothing reading Solutions, hashers keep hashing under the dropping
+// policies, and count what they drop
+func TestSolutionPolicy(t *testing.T) {
+	lx, err := pow.New(pow.Options{Loops: 1, Bits: 8, Passes: 1, Store: pow.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+
+	hash := sha256.Sum256([]byte("policy"))
+	for _, policy := range []SolutionPolicy{PolicyBlock, PolicyDropLower, PolicyBestN} {
+		m := NewHashers(2, 1, lx)
+		m.SetSolutionPolicy(policy, 4)
+		m.Start()
+		m.BlockHashes <- Hash{Hash: hash, Block: 1, Limit: 0xF000000000000000}
+		time.Sleep(200 * time.Millisecond)
+		m.Stop()
+
+		s := m.Stats()
+		switch policy {
+		case PolicyBlock:
+			if s.Dropped != 0 || s.Hashes > 1000 {
+				t.Errorf("block: expected hashers to stall without dropping, got %d hashes and %d dropped", s.Hashes, s.Dropped)
+			}
+		default:
+			if s.Dropped == 0 || s.Hashes < 1000 {
+				t.Errorf("%v: expected hashers to keep hashing and drop, got %d hashes and %d dropped", policy, s.Hashes, s.Dropped)
+			}
+		}
+
+		if policy != PolicyBestN {
+			continue
+		}
+		var best uint64 // The best PoW is kept, in Solutions or the buffer
+		for len(m.Solutions) > 0 {
+			best = max(best, (<-m.Solutions).Pow)
+		}
+		for s, ok := m.buffer.pop(); ok; s, ok = m.buffer.pop() {
+			best = max(best, s.Pow)
+		}
+		if len(s.Blocks) != 1 || best != s.Blocks[0].Best {
+			t.Errorf("bestn: best PoW %+v not kept, found %x", s.Blocks, best)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package hashing
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// StatsInterval is how often a running HasherSet samples its hash count to
+// update its hash rates
+const StatsInterval = 5 * time.Second
+
+// bestBlocks is how many recent blocks each Hasher keeps its best PoW for
+const bestBlocks = 16
+
+// rateWindows are the windows the hash rates are averaged over, like load averages
+var rateWindows = [3]time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// BlockBest
+// The best PoW found for a block
+type BlockBest struct {
+	Block uint64   // Block number sent with the hash; 0 if none was
+	Hash  [32]byte // The hash of the block
+	Best  uint64   // Best PoW found
+}
+
+// InstanceStats
+// What one Hasher has done
+type InstanceStats struct {
+	Instance  int
+	Hashes    uint64 // Hashes performed
+	Solutions uint64 // Solutions found
+	Dropped   uint64 // Solutions dropped by the policy, including those of other Hashers it displaced
+}
+
+// Stats
+// A snapshot of what a HasherSet has done
+type Stats struct {
+	Hashes    uint64      // Hashes performed by every Hasher
+	Dropped   uint64      // Solutions dropped by the policy of every Hasher
+	Rate1     float64     // Hashes per second, averaged exponentially over 1 minute
+	Rate5     float64     // Hashes per second, averaged exponentially over 5 minutes
+	Rate15    float64     // Hashes per second, averaged exponentially over 15 minutes
+	Blocks    []BlockBest // Best PoW of each recent block, oldest first
+	Instances []InstanceStats
+
+	// Counts of the DuplicateSampler, which include every HasherSet sharing it
+	SampledNonces   uint64  // Sampled nonces recorded
+	DuplicateNonces uint64  // Sampled nonces that had already been tried on the same hash
+	DuplicateRate   float64 // DuplicateNonces over SampledNonces, an estimate of the share of repeated work
+}
+
+// SolutionCount returns the count of solutions found.  It is safe to call while
+// the Hasher is running.
+func (m *Hasher) SolutionCount() uint64 {
+	return m.solutions.Load()
+}
+
+// DroppedCount returns the count of solutions dropped by the policy.  It is safe
+// to call while the Hasher is running.
+func (m *Hasher) DroppedCount() uint64 {
+	return m.dropped.Load()
+}
+
+// Bests returns the best PoW of each recent block, oldest first.  It is safe to
+// call while the Hasher is running.
+func (m *Hasher) Bests() []BlockBest {
+	m.bestMutex.Lock()
+	defer m.bestMutex.Unlock()
+	return append([]BlockBest(nil), m.bests...)
+}
+
+// recordBest
+// Records a new best PoW for the block.  The hashing loop only calls it when its
+// best improves, which happens about ln(hashes) times a block, so the lock is
+// rarely taken.
+func (m *Hasher) recordBest(block uint64, hash [32]byte, best uint64) {
+	m.bestMutex.Lock()
+	defer m.bestMutex.Unlock()
+	if n := len(m.bests); n > 0 && m.bests[n-1].Hash == hash && m.bests[n-1].Block == block {
+		m.bests[n-1].Best = best
+		return
+	}
+	if len(m.bests) == bestBlocks {
+		m.bests = append(m.bests[:0], m.bests[1:]...)
+	}
+	m.bests = append(m.bests, BlockBest{block, hash, best})
+}
+
+// Stats returns a snapshot of the hashes, hash rates, best PoWs and solutions of
+// the HasherSet.  It is safe to call while the HasherSet is running.
+func (h *HasherSet) Stats() Stats {
+	var s Stats
+	for _, i := range h.Instances {
+		is := InstanceStats{Instance: i.Instance, Hashes: i.HashCount(), Solutions: i.SolutionCount(), Dropped: i.DroppedCount()}
+		s.Hashes += is.Hashes
+		s.Dropped += is.Dropped
+		s.Instances = append(s.Instances, is)
+		s.Blocks = mergeBests(s.Blocks, i.Bests())
+	}
+	sort.SliceStable(s.Blocks, func(a, b int) bool { return s.Blocks[a].Block < s.Blocks[b].Block }) // A Hasher may skip a block
+	if len(s.Blocks) > bestBlocks {
+		s.Blocks = s.Blocks[len(s.Blocks)-bestBlocks:]
+	}
+	if h.Duplicates != nil {
+		s.SampledNonces, s.DuplicateNonces = h.Duplicates.Counts()
+		if s.SampledNonces > 0 {
+			s.DuplicateRate = float64(s.DuplicateNonces) / float64(s.SampledNonces)
+		}
+	}
+	h.statsMutex.Lock()
+	s.Rate1, s.Rate5, s.Rate15 = h.rates[0], h.rates[1], h.rates[2]
+	h.statsMutex.Unlock()
+	return s
+}
+
+// mergeBests merges the bests of a Hasher into the bests of the set, keeping the
+// best PoW of each block.  Blocks keep the order they were first seen in, which
+// depends on the order of the Hashers when one skipped a block.
+func mergeBests(set, bests []BlockBest) []BlockBest {
+next:
+	for _, b := range bests {
+		for i := range set {
+			if set[i].Hash == b.Hash && set[i].Block == b.Block {
+				set[i].Best = max(set[i].Best, b.Best)
+				continue next
+			}
+		}
+		set = append(set, b)
+	}
+	return set
+}
+
+// sample
+// Updates the hash rates with the hashes done since the last sample.  Each rate
+// is an exponentially weighted moving average, which starts at the first rate
+// measured.
+func (h *HasherSet) sample(now time.Time) {
+	var hashes uint64
+	for _, i := range h.Instances {
+		hashes += i.HashCount()
+	}
+	h.statsMutex.Lock()
+	defer h.statsMutex.Unlock()
+	if !h.sampled.IsZero() {
+		elapsed := now.Sub(h.sampled)
+		if elapsed <= 0 {
+			return
+		}
+		rate := float64(hashes-h.sampledHashes) / elapsed.Seconds()
+		for w, window := range rateWindows {
+			if !h.rated {
+				h.rates[w] = rate
+				continue
+			}
+			alpha := 1 - math.Exp(-elapsed.Seconds()/window.Seconds())
+			h.rates[w] += alpha * (rate - h.rates[w])
+		}
+		h.rated = true
+	}
+	h.sampled, h.sampledHashes = now, hashes
+}
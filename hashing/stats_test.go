@@ -0,0 +1,111 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package hashing
+
+import (
+	"crypto/sha256"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pegnet/LXRPow/pow"
+)
+
+func TestStats(t *testing.T) {
+	lx, err := pow.New(pow.Options{Loops: 8, Bits: 8, Passes: 6, Store: pow.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	m := NewHashers(2, 523452345, lx)
+	m.Start()
+	defer m.Stop()
+
+	// Mine two blocks, reading every solution
+	hashes := [2][32]byte{sha256.Sum256([]byte{1}), sha256.Sum256([]byte{2})}
+	solutions := 0
+	for block, hash := range hashes {
+		m.BlockHashes <- Hash{Hash: hash, Block: uint64(block + 1), Limit: 0xF000000000000000}
+		for found := 0; found < 20; {
+			if s := <-m.Solutions; s.DNHash == hash {
+				if s.Block != uint64(block+1) {
+					t.Errorf("solution reported for block %d, expected %d", s.Block, block+1)
+				}
+				found++
+			}
+			solutions++
+		}
+	}
+
+	s := m.Stats()
+	if len(s.Instances) != 2 {
+		t.Fatalf("expected 2 instances, got %d", len(s.Instances))
+	}
+	var sum, emitted uint64
+	for _, is := range s.Instances {
+		sum += is.Hashes
+		emitted += is.Solutions
+	}
+	if s.Hashes != sum || s.Hashes == 0 {
+		t.Errorf("hashes %d do not sum the instances' %d", s.Hashes, sum)
+	}
+	if emitted < uint64(solutions) {
+		t.Errorf("%d solutions counted, but %d were read", emitted, solutions)
+	}
+	if len(s.Blocks) != 2 {
+		t.Fatalf("expected the bests of 2 blocks, got %+v", s.Blocks)
+	}
+	for i, b := range s.Blocks {
+		if b.Block != uint64(i+1) || b.Hash != hashes[i] || b.Best <= 0xF000000000000000 {
+			t.Errorf("wrong best for block %d: %+v", i+1, b)
+		}
+	}
+}
+
+func TestStats_Rates(t *testing.T) {
+	m := NewHashers(2, 1, nil)
+	start := time.Now()
+	m.sample(start)
+	if s := m.Stats(); s.Rate1 != 0 {
+		t.Errorf("rate %f before any hashing", s.Rate1)
+	}
+
+	// The first rate measured starts every average
+	m.Instances[0].hashCnt.Store(3000)
+	m.Instances[1].hashCnt.Store(2000)
+	m.sample(start.Add(5 * time.Second))
+	if s := m.Stats(); s.Rate1 != 1000 || s.Rate5 != 1000 || s.Rate15 != 1000 {
+		t.Errorf("expected rates of 1000, got %+v", s)
+	}
+
+	// After a minute at 2000 hashes a second, the 1 minute average has moved most
+	// of the way, and the longer ones less so
+	hashes := uint64(3000) // Hashes of the first instance
+	for i := 2; i <= 13; i++ {
+		hashes += 10000
+		m.Instances[0].hashCnt.Store(hashes)
+		m.sample(start.Add(time.Duration(i) * 5 * time.Second))
+	}
+	s := m.Stats()
+	if want := 2000 - 1000*math.Exp(-1); math.Abs(s.Rate1-want) > 1e-6 {
+		t.Errorf("expected a 1 minute rate of %f, got %f", want, s.Rate1)
+	}
+	if !(s.Rate1 > s.Rate5 && s.Rate5 > s.Rate15 && s.Rate15 > 1000) {
+		t.Errorf("rates are not ordered by window: %+v", s)
+	}
+}
+
+func TestRecordBest(t *testing.T) {
+	m := NewHasher(0, 1, nil)
+	for b := uint64(1); b <= bestBlocks+4; b++ {
+		m.recordBest(b, [32]byte{byte(b)}, b)
+		m.recordBest(b, [32]byte{byte(b)}, b*10)
+	}
+	bests := m.Bests()
+	if len(bests) != bestBlocks {
+		t.Fatalf("expected %d blocks kept, got %d", bestBlocks, len(bests))
+	}
+	if first := bests[0]; first.Block != 5 || first.Best != 50 {
+		t.Errorf("expected the oldest kept to be block 5 with 50, got %+v", first)
+	}
+}
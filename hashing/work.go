@@ -0,0 +1,144 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package hashing
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pegnet/LXRPow/pow"
+)
+
+// NonceRange
+// The nonces from Start up to, but not including, End.  An empty range leaves the
+// Hasher to pick nonces with its NonceSource.
+type NonceRange struct {
+	Start uint64
+	End   uint64
+}
+
+// Empty reports if the range holds no nonces
+func (r NonceRange) Empty() bool {
+	return r.End <= r.Start
+}
+
+// Job
+// A unit of work for a Hasher: a hash to find solutions of, and how long and over
+// which nonces to search
+type Job struct {
+	ID     uint64        // Identifies the job; solutions carry it back
+	Hash   [32]byte      // The hash to work on
+	Block  uint64        // Block number of the hash, reported with solutions and best PoWs
+	Limit  uint64        // Solutions must be over the given limit
+	Alg    pow.Algorithm // Algorithm to hash with; if nil, the LxrPow of the hasher is used
+	Lease  *pow.Lease    // Keeps Alg from being closed while the job is worked on; may be nil
+	Nonces NonceRange    // Nonces to try; if empty, the Hasher's NonceSource picks them
+	Expiry time.Time     // The Hasher stops working on the job after; zero never expires
+}
+
+// Expired reports if the job has expired by the given time
+func (j Job) Expired(now time.Time) bool {
+	return !j.Expiry.IsZero() && now.After(j.Expiry)
+}
+
+// WorkSource
+// Hands out the jobs Hashers work on.  Each Hasher pulls its own job, so a source
+// can give Hashers different nonce ranges.  Job IDs increase, and the jobs handed
+// out together share an ID; results of a job older than the latest are stale.
+type WorkSource interface {
+	// Next waits for a job newer than the one with the given ID (0 before the first
+	// job), and returns it for the given instance.  It returns the context's error if
+	// the context is done first.  A job's Lease is retained for the Hasher, which
+	// releases it once it is done with the job.
+	Next(ctx context.Context, instance int, after uint64) (Job, error)
+	// Latest returns the ID of the newest job.  Hashers call it for every hash, so
+	// it must be cheap.
+	Latest() uint64
+}
+
+// HashSource
+// The WorkSource of hashes pushed with Set, or sent on BlockHashes.  Every Hasher
+// gets the same job, and picks its own nonces.
+type HashSource struct {
+	latest  atomic.Uint64
+	mutex   sync.Mutex    // Protects job and changed
+	job     Job           // The newest job
+	changed chan struct{} // Closed when a newer job is set
+}
+
+// NewHashSource returns a HashSource with no job
+func NewHashSource() *HashSource {
+	return &HashSource{changed: make(chan struct{})}
+}
+
+// Set makes the hash the newest job, and returns it.  The caller keeps its lease
+// on the hash's algorithm until a newer job is set.
+func (s *HashSource) Set(h Hash) Job {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.job = Job{
+		ID:     s.job.ID + 1,
+		Hash:   h.Hash,
+		Block:  h.Block,
+		Limit:  h.Limit,
+		Alg:    h.Alg,
+		Lease:  h.Lease,
+		Expiry: h.Expiry,
+	}
+	s.latest.Store(s.job.ID)
+	close(s.changed)
+	s.changed = make(chan struct{})
+	return s.job
+}
+
+// Feed sets every hash sent on hashes until the context is done
+func (s *HashSource) Feed(ctx context.Context, hashes <-chan Hash) error {
+	for {
+		select {
+		case h := <-hashes:
+			s.Set(h)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *HashSource) Next(ctx context.Context, instance int, after uint64) (Job, error) {
+	for {
+		s.mutex.Lock()
+		job, changed := s.job, s.changed
+		if job.ID > after { // Retained before a newer job is set, while the caller holds the lease
+			job.Lease = job.Lease.Retain()
+			s.mutex.Unlock()
+			return job, nil
+		}
+		s.mutex.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return Job{}, ctx.Err()
+		}
+	}
+}
+
+func (s *HashSource) Latest() uint64 {
+	return s.latest.Load()
+}
+
+// Stale reports if a solution's job is older than the latest job of the source
+func Stale(w WorkSource, s PoWSolution) bool {
+	return s.JobID != w.Latest()
+}
+
+// SetWork
+// Has every Hasher of the set pull its jobs from the given source.  Run only reads
+// BlockHashes if the source is a HashSource.  It must not be called while the
+// HasherSet is running.
+func (h *HasherSet) SetWork(work WorkSource) {
+	h.Work = work
+	for _, i := range h.Instances {
+		i.Work = work
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package hashing
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pegnet/LXRPow/pow"
+)
+
+func TestHashSource(t *testing.T) {
+	s := NewHashSource()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.Next(ctx, 0, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected to wait for a job, got %v", err)
+	}
+
+	first := s.Set(Hash{Hash: [32]byte{1}, Block: 7, Limit: 9})
+	if first.ID != 1 || first.Hash != [32]byte{1} || first.Block != 7 || first.Limit != 9 || s.Latest() != 1 {
+		t.Errorf("wrong first job %+v", first)
+	}
+	if j, err := s.Next(context.Background(), 0, 0); err != nil || j.ID != first.ID {
+		t.Errorf("expected the first job, got %+v, %v", j, err)
+	}
+
+	// Next waits for a newer job
+	got := make(chan Job)
+	go func() {
+		j, _ := s.Next(context.Background(), 0, first.ID)
+		got <- j
+	}()
+	second := s.Set(Hash{Hash: [32]byte{2}})
+	if j := <-got; j.ID != second.ID || j.Hash != [32]byte{2} {
+		t.Errorf("expected the second job, got %+v", j)
+	}
+	if !Stale(s, PoWSolution{JobID: first.ID}) || Stale(s, PoWSolution{JobID: second.ID}) {
+		t.Error("only solutions of the first job are stale")
+	}
+}
+
+// rangeSource gives each instance its own range of nonces
+type rangeSource struct {
+	job Job
+}
+
+func (r *rangeSource) Next(ctx context.Context, instance int, after uint64) (Job, error) {
+	if after >= r.job.ID {
+		<-ctx.Done()
+		return Job{}, ctx.Err()
+	}
+	j := r.job
+	j.Nonces = NonceRange{Start: uint64(instance) * 1000, End: uint64(instance)*1000 + 100}
+	return j, nil
+}
+
+func (r *rangeSource) Latest() uint64 { return r.job.ID }
+
+func TestWorkSource(t *testing.T) {
+	lx, err := pow.New(pow.Options{Loops: 1, Bits: 8, Passes: 1, Store: pow.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+
+	// Every nonce of each range is tried once, then the Hashers wait for more work
+	m := NewHashers(2, 1, lx)
+	m.SetWork(&rangeSource{Job{ID: 5, Hash: sha256.Sum256([]byte("work")), Limit: 0}})
+	m.Start()
+	nonces := map[uint64]bool{}
+	for len(nonces) < 200 {
+		s := <-m.Solutions
+		if s.JobID != 5 {
+			t.Fatalf("solution carries job %d, expected 5", s.JobID)
+		}
+		if nonces[s.Nonce] || s.Nonce%1000 >= 100 || s.Nonce/1000 != uint64(s.Instance) {
+			t.Fatalf("nonce %d of instance %d is repeated or outside its range", s.Nonce, s.Instance)
+		}
+		nonces[s.Nonce] = true
+	}
+	time.Sleep(10 * time.Millisecond)
+	if s := m.Stats(); s.Hashes != 200 {
+		t.Errorf("expected 200 hashes, got %d", s.Hashes)
+	}
+	m.Stop()
+
+	// An expired job is not worked on
+	m = NewHashers(1, 1, lx)
+	m.Start()
+	defer m.Stop()
+	m.BlockHashes <- Hash{Hash: [32]byte{1}, Limit: 0, Expiry: time.Now().Add(-time.Second)}
+	time.Sleep(10 * time.Millisecond)
+	if h := m.Stats().Hashes; h != 0 {
+		t.Errorf("%d hashes of an expired job", h)
+	}
+	m.BlockHashes <- Hash{Hash: [32]byte{2}, Limit: 0, Expiry: time.Now().Add(20 * time.Millisecond)}
+	if s := <-m.Solutions; s.DNHash != [32]byte{2} || s.JobID != 2 {
+		t.Errorf("expected a solution of job 2, got %+v", s)
+	}
+	time.Sleep(30 * time.Millisecond)
+	for len(m.Solutions) > 0 {
+		<-m.Solutions
+	}
+	stopped := m.Stats().Hashes
+	time.Sleep(10 * time.Millisecond)
+	if h := m.Stats().Hashes; h != stopped {
+		t.Errorf("hashing went on after the job expired: %d then %d hashes", stopped, h)
+	}
+}
+
+// Solutions of a job are stale once a newer one is set, even those still waiting
+// to be read
+func TestStaleSolutions(t *testing.T) {
+	lx, err := pow.New(pow.Options{Loops: 1, Bits: 8, Passes: 1, Store: pow.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+
+	work := NewHashSource()
+	m := NewHashers(2, 1, lx)
+	m.SetWork(work)
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.Run(ctx)
+	}()
+	defer wg.Wait()
+	defer cancel()
+
+	old := work.Set(Hash{Hash: [32]byte{1}, Limit: 0})
+	for len(m.Solutions) < cap(m.Solutions) { // Let solutions of the old job pile up
+		time.Sleep(time.Millisecond)
+	}
+	current := work.Set(Hash{Hash: [32]byte{2}, Limit: 0})
+	stale := 0
+	for {
+		s := <-m.Solutions
+		if !Stale(work, s) {
+			if s.JobID != current.ID || s.DNHash != [32]byte{2} {
+				t.Fatalf("solution %+v is not of the current job", s)
+			}
+			break
+		}
+		if s.JobID != old.ID {
+			t.Fatalf("stale solution of job %d", s.JobID)
+		}
+		stale++
+	}
+	if stale < cap(m.Solutions) {
+		t.Errorf("expected at least %d stale solutions, got %d", cap(m.Solutions), stale)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pegnet/LXRPow/pow"
+	"github.com/pegnet/LXRPow/pow/analyze"
+	"github.com/pegnet/LXRPow/pow/memhard"
+	"github.com/pegnet/LXRPow/pow/profile"
+)
+
+// commands are the subcommands of lxrpow
+var commands = map[string]func(args []string) error{
+	"bench":   bench,
+	"analyze": analyzeCmd,
+	"memhard": memhardCmd,
+}
+
+func main() {
+	if len(os.Args) < 2 || commands[os.Args[1]] == nil {
+		fmt.Fprintf(os.Stderr, "usage: lxrpow <command> [flags]\n\ncommands:\n")
+		fmt.Fprintf(os.Stderr, "  bench    report hash rates and ByteMap cache behaviour as JSON\n")
+		fmt.Fprintf(os.Stderr, "  analyze  report the statistical quality of ByteMaps and LxrPoW output as JSON\n")
+		fmt.Fprintf(os.Stderr, "  memhard  report how a reduced ByteMap trades hash rate for wrong PoWs as JSON\n")
+		os.Exit(2)
+	}
+	if err := commands[os.Args[1]](os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "lxrpow %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// BenchReport is written by the bench command
+type BenchReport struct {
+	Time      time.Time        `json:"time"`
+	GoVersion string           `json:"goVersion"`
+	GOOS      string           `json:"goos"`
+	GOARCH    string           `json:"goarch"`
+	CPUs      int              `json:"cpus"`
+	Results   []profile.Result `json:"results"`
+}
+
+// bench
+// Profiles LxrPoW for every combination of the loops and bits given, and writes
+// the results to stdout as JSON
+func bench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	pLoops := fs.String("loops", "16,32,50", "comma separated Loops to profile")
+	pBits := fs.String("bits", "16,20,24", "comma separated Bits to profile")
+	pPasses := fs.Int("passes", 6, "Passes used to generate the ByteMap")
+	pGenerator := fs.Uint("generator", uint(pow.GeneratorLegacy), "ByteMap generator version")
+	pDuration := fs.Duration("duration", 5*time.Second, "how long to hash for each profile")
+	pInstances := fs.Int("instances", 0, "goroutines hashing at once (0 uses every core)")
+	pCache := fs.Int("cache", profile.DefaultCacheBytes, "bytes of CPU cache to simulate")
+	pSamples := fs.Int("samples", profile.DefaultSamples, "hashes traced through the simulated cache")
+	pTableDir := fs.String("tabledir", "", "directory ByteMaps are cached in (default $"+pow.TableDirEnv+" or ~/.lxrpow)")
+	fs.Parse(args)
+
+	loops, err := parseInts(*pLoops)
+	if err != nil {
+		return fmt.Errorf("bad --loops: %w", err)
+	}
+	bits, err := parseInts(*pBits)
+	if err != nil {
+		return fmt.Errorf("bad --bits: %w", err)
+	}
+
+	report := BenchReport{
+		Time:      time.Now(),
+		GoVersion: runtime.Version(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+	}
+	cfg := profile.Config{Duration: *pDuration, Instances: *pInstances, CacheBytes: *pCache, Samples: *pSamples}
+	for _, b := range bits {
+		for _, l := range loops {
+			lx, err := pow.New(pow.Options{Loops: l, Bits: b, Passes: *pPasses,
+				Generator: pow.GeneratorVersion(*pGenerator), TableDir: *pTableDir})
+			if err != nil {
+				return err
+			}
+			report.Results = append(report.Results, profile.Run(lx, cfg))
+			lx.Close()
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// AnalyzeReport is written by the analyze command
+type AnalyzeReport struct {
+	Time    time.Time        `json:"time"`
+	Reports []analyze.Report `json:"reports"`
+}
+
+// analyzeCmd
+// Analyzes the ByteMap for every combination of the bits and passes given, and
+// writes the reports to stdout as JSON
+func analyzeCmd(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	pLoops := fs.Int("loops", 16, "Loops used to sample LxrPoW output")
+	pBits := fs.String("bits", "16,20", "comma separated Bits to analyze")
+	pPasses := fs.String("passes", "1,2,6", "comma separated Passes to analyze")
+	pGenerator := fs.Uint("generator", uint(pow.GeneratorLegacy), "ByteMap generator version")
+	pSamples := fs.Int("samples", analyze.DefaultSamples, "LxrPoW outputs sampled for uniformity")
+	pCycleBits := fs.Int("cyclebits", analyze.DefaultCycleBits, "largest Bits to find cycles for (4 bytes of memory per ByteMap byte)")
+	pTableDir := fs.String("tabledir", "", "directory ByteMaps are cached in (default $"+pow.TableDirEnv+" or ~/.lxrpow)")
+	fs.Parse(args)
+
+	bits, err := parseInts(*pBits)
+	if err != nil {
+		return fmt.Errorf("bad --bits: %w", err)
+	}
+	passes, err := parseInts(*pPasses)
+	if err != nil {
+		return fmt.Errorf("bad --passes: %w", err)
+	}
+
+	report := AnalyzeReport{Time: time.Now()}
+	cfg := analyze.Config{Samples: *pSamples, CycleBits: *pCycleBits}
+	for _, b := range bits {
+		for _, p := range passes {
+			lx, err := pow.New(pow.Options{Loops: *pLoops, Bits: b, Passes: p,
+				Generator: pow.GeneratorVersion(*pGenerator), TableDir: *pTableDir})
+			if err != nil {
+				return err
+			}
+			report.Reports = append(report.Reports, analyze.Analyze(lx, cfg))
+			lx.Close()
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// MemhardReport is written by the memhard command
+type MemhardReport struct {
+	Time    time.Time        `json:"time"`
+	Reports []memhard.Report `json:"reports"`
+}
+
+// memhardCmd
+// Measures the time-memory tradeoff of LxrPoW for every combination of the loops
+// and bits given, and writes the reports to stdout as JSON
+func memhardCmd(args []string) error {
+	fs := flag.NewFlagSet("memhard", flag.ExitOnError)
+	pLoops := fs.String("loops", "16", "comma separated Loops to measure")
+	pBits := fs.String("bits", "20,24", "comma separated Bits to measure")
+	pPasses := fs.Int("passes", 6, "Passes used to generate the ByteMap")
+	pGenerator := fs.Uint("generator", uint(pow.GeneratorLegacy), "ByteMap generator version")
+	pTableBits := fs.String("tablebits", "", "comma separated reduced table Bits (default every 2 bits below --bits, down to 8)")
+	pDuration := fs.Duration("duration", memhard.DefaultDuration, "how long to hash with each table size")
+	pSamples := fs.Int("samples", memhard.DefaultSamples, "hashes checked against LxrPoW for each table size")
+	pTableDir := fs.String("tabledir", "", "directory ByteMaps are cached in (default $"+pow.TableDirEnv+" or ~/.lxrpow)")
+	fs.Parse(args)
+
+	loops, err := parseInts(*pLoops)
+	if err != nil {
+		return fmt.Errorf("bad --loops: %w", err)
+	}
+	bits, err := parseInts(*pBits)
+	if err != nil {
+		return fmt.Errorf("bad --bits: %w", err)
+	}
+	cfg := memhard.Config{Duration: *pDuration, Samples: *pSamples}
+	if *pTableBits != "" {
+		if cfg.TableBits, err = parseInts(*pTableBits); err != nil {
+			return fmt.Errorf("bad --tablebits: %w", err)
+		}
+	}
+
+	report := MemhardReport{Time: time.Now()}
+	for _, b := range bits {
+		for _, l := range loops {
+			lx, err := pow.New(pow.Options{Loops: l, Bits: b, Passes: *pPasses,
+				Generator: pow.GeneratorVersion(*pGenerator), TableDir: *pTableDir})
+			if err != nil {
+				return err
+			}
+			r, err := memhard.Run(lx, cfg)
+			lx.Close()
+			if err != nil {
+				return err
+			}
+			report.Reports = append(report.Reports, r)
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// parseInts parses a comma separated list of integers
+func parseInts(list string) (values []int, err error) {
+	for _, s := range strings.Split(list, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
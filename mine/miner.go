@@ -1,12 +1,13 @@
 package mine
 
 import (
-	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/pegnet/LXRPow/accumulate"
 	"github.com/pegnet/LXRPow/cfg"
 	"github.com/pegnet/LXRPow/hashing"
+	"github.com/pegnet/LXRPow/pow"
 )
 
 type Miner struct {
@@ -16,6 +17,9 @@ type Miner struct {
 	Solutions chan hashing.PoWSolution
 	Control   chan string
 	MinersIdx uint64
+	Logger    *slog.Logger
+	Jobs      *hashing.HashSource // Jobs of the hashers, one for each block
+	Stale     uint64              // Solutions dropped because the block changed
 }
 
 func (m *Miner) Init(cfg *cfg.Config) {
@@ -29,13 +33,64 @@ func (m *Miner) Init(cfg *cfg.Config) {
 	m.Hashers = hashing.NewHashers(cfg.Instances, cfg.Seed, cfg.LX) // Allocate the Hashers
 	m.Hashers.SetSolutions(m.Solutions)                             // Override their Solutions channel
 	m.MinersIdx = accumulate.MiningADI.RegisterMiner(m.Cfg.TokenURL)
+
+	m.Logger = cfg.Logger
+	if m.Logger == nil {
+		m.Logger = pow.DiscardLogger()
+	}
+	m.Logger = m.Logger.With("miner", m.MinersIdx, "index", cfg.Index)
+	m.Hashers.Logger = m.Logger
+
+	m.Hashers.SetSolutionPolicy(cfg.Policy, cfg.BestN) // Whether hashers wait while the miner is busy
+	m.Jobs = hashing.NewHashSource()
+	m.Hashers.SetWork(m.Jobs) // Solutions carry the job, so those of old blocks are dropped
+	if cfg.Duplicates != nil {
+		m.Hashers.SetDuplicates(cfg.Duplicates) // Count repeated work across all the miners
+	}
+	if !cfg.LegacyNonces() { // Miners of processes with distinct indexes never search the same nonces
+		miner, err := cfg.NonceMiner(m.MinersIdx)
+		if err == nil {
+			err = m.Hashers.UsePartitionedNonces(miner)
+		}
+		if err != nil {
+			m.Logger.Warn("using legacy nonces", "error", err)
+		}
+	}
 }
 
 func (m *Miner) Stop() {
-	fmt.Printf("Miner %2d has stopped", m.Cfg.Index)
+	m.Logger.Info("miner has stopped")
 	m.Hashers.Stop()
 }
 
+// algorithm
+// Returns a lease on the PoW algorithm the settings activate, waiting for it to be
+// built if the Manager has not prepared it; Run only asks once it is Ready.  Without
+// a Manager, the lease holds nothing, and the hashers use the LxrPow they were
+// created with.
+func (m *Miner) algorithm(settings accumulate.Settings) (*pow.Lease, error) {
+	if m.Cfg.Manager == nil {
+		return &pow.Lease{}, nil
+	}
+	return m.Cfg.Manager.Get(settings.AlgorithmKey())
+}
+
+// pow256
+// Computes the 256 bit PoW of a solution, for settings that rank submissions on it.
+// Hashers only report the 64 bit PoW, so the solution's nonce is hashed again.
+func (m *Miner) pow256(alg pow.Algorithm, solution hashing.PoWSolution) pow.Pow256 {
+	if alg == nil {
+		alg = m.Cfg.LX
+	}
+	if alg256, ok := alg.(pow.Algorithm256); ok {
+		if p, err := alg256.PoW256(solution.DNHash[:], solution.Nonce); err == nil {
+			return p
+		}
+	}
+	m.Logger.Warn("no 256 bit PoW for solution", "nonce", solution.Nonce)
+	return pow.Pow256{}
+}
+
 // Run
 // The job of the miner is to find the best hash it can from its hashers
 // When hashers find a solution, those are fed to WriteSolution.  WriteSolution
@@ -46,8 +101,14 @@ func (m *Miner) Run() {
 	}
 	m.Started = true
 
-	var limit uint64 = 0xFFF0000000000000
+	limit := uint64(m.Cfg.Limit) // Hashers report solutions over the limit
+	if limit == 0 {
+		limit = uint64(pow.DifficultyFromBits(12))
+	}
 	var settings accumulate.Settings
+	lease := &pow.Lease{} // Algorithm of the block being mined; nil is the LxrPow of the config
+	var pending [32]byte  // DNHash of the block waiting for its algorithm to be built
+	defer func() { lease.Release() }()
 	HashCounts := make(map[int]uint64)
 	for {
 		select {
@@ -55,6 +116,11 @@ func (m *Miner) Run() {
 
 			HashCounts[int(solution.Instance)] = solution.HashCnt // Collect all the hashing counts from hashers
 
+			if hashing.Stale(m.Jobs, solution) { // Found for a block no longer being mined
+				m.Stale++
+				continue
+			}
+
 			if solution.Pow > limit { // If the best so far on the block
 				solution.TokenURL = m.Cfg.TokenURL // Save the TokenURL
 				submission := new(accumulate.Submission)
@@ -65,6 +131,9 @@ func (m *Miner) Run() {
 				submission.MinerIdx = m.MinersIdx
 				submission.Nonce = solution.Nonce
 				submission.PoW = solution.Pow
+				if settings.Uses256() {
+					submission.PoW256 = m.pow256(lease.Alg, solution)
+				}
 				accumulate.MiningADI.AddSubmission(*submission)
 			}
 			continue
@@ -78,10 +147,29 @@ func (m *Miner) Run() {
 		}
 		newSettings := accumulate.MiningADI.Sync() // Get the current state of mining
 		if newSettings.DNHash != settings.DNHash {
-			
-			settings = newSettings
-			m.Hashers.BlockHashes <- hashing.Hash{Hash:settings.DNHash,Limit:limit} // Send the hash to the hashers
-			if !m.Hashers.Started {                  // If hashers are not started, do so after we have a hash set to them.
+			if key := newSettings.AlgorithmKey(); m.Cfg.Manager != nil && !m.Cfg.Manager.Ready(key) {
+				if newSettings.DNHash != pending { // Keep reading solutions while it is built
+					pending = newSettings.DNHash
+					m.Cfg.Manager.Prepare(key)
+					m.Logger.Info("waiting for PoW algorithm", "block", newSettings.BlockIndex, "algorithm", key)
+				}
+				time.Sleep(time.Second / 100)
+				continue
+			}
+			newLease, err := m.algorithm(newSettings) // Hashers switch algorithms with the block
+			if err != nil {
+				m.Logger.Error("no PoW algorithm for block", "block", newSettings.BlockIndex, "error", err)
+				time.Sleep(time.Second)
+				continue
+			}
+			oldLease := lease
+			settings, lease = newSettings, newLease
+			stats := m.Hashers.Stats()
+			m.Logger.Debug("mining new block", "block", settings.BlockIndex, "dnindex", settings.DNIndex,
+				"hashes", stats.Hashes, "rate1m", stats.Rate1, "rate5m", stats.Rate5, "rate15m", stats.Rate15, "duplicates", stats.DuplicateRate, "dropped", stats.Dropped, "stale", m.Stale)
+			m.Jobs.Set(hashing.Hash{Hash: settings.DNHash, Block: settings.BlockIndex, Limit: limit, Alg: lease.Alg, Lease: lease}) // Send the hash to the hashers
+			oldLease.Release()                                                                                                      // Hashers still on the old job hold their own lease
+			if !m.Hashers.Started() {                                                                                               // If hashers are not started, do so after we have a hash set to them.
 				m.Hashers.Start()
 			}
 		} else {
@@ -5,6 +5,7 @@ package main
 import (
 	//"fmt"
 	//"os"
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -18,11 +19,17 @@ import (
 )
 
 func main() {
-	c := cfg.NewConfig()
+	// Ctrl+C while the ByteMap is loading or generating stops the miner
+	ctx, cancel := context.WithCancel(context.Background())
+	AddInterruptHandler(cancel)
+	c := cfg.NewConfigContext(ctx)
+	go c.Manager.Watch(accumulate.MiningADI.Scheduled, time.Second, nil) // Prepare algorithms of new settings
 
 	var validatorList []*validator.Validator
 	for i := 0; i < 1; i++ { // Just running one validator for now
 		v := validator.NewValidator(sim.GetURL(),c.LX)
+		v.Logger = c.Logger.With("validator", v.URL)
+		v.Manager = c.Manager
 		accumulate.MiningADI.RegisterMiner(v.URL)
 		validatorList = append(validatorList, v)
 	}
@@ -44,10 +51,7 @@ func main() {
 	}
 
 	AddInterruptHandler(func() {
-		fmt.Print("<Break>\n")
-		fmt.Print("Gracefully shutting down the mining simulation...\n")
-
-		fmt.Print("Waiting...\r\n")
+		c.Logger.Info("gracefully shutting down the mining simulation")
 		time.Sleep(3 * time.Second)
 		os.Exit(0)
 	})
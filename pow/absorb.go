@@ -0,0 +1,50 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// AbsorbDomain is prefixed to everything Absorb hashes, so absorbed input can never
+// collide with a plain SHA-256 digest of the same bytes.
+const AbsorbDomain = "LxrPoW absorb v1"
+
+// Absorb
+// Folds input of any length into the 32 byte hash LxrPoW works on.  Every input,
+// whether a digest (SHA-256, SHA-384, SHA-512, BLAKE2b) or a raw preimage such as
+// a block header, is absorbed the same way, whatever its length:
+//
+//	SHA-256(AbsorbDomain || uint64 big endian length of input || input)
+//
+// The length prefix keeps inputs that differ only in trailing bytes apart.  A 32
+// byte digest absorbs to a different hash than itself; to mine a 32 byte hash as
+// LxrPoW always has, call LxrPoW with it directly.
+func Absorb(input []byte) (hash [32]byte) {
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(input)))
+	h := sha256.New()
+	h.Write([]byte(AbsorbDomain))
+	h.Write(length[:])
+	h.Write(input)
+	h.Sum(hash[:0])
+	return hash
+}
+
+// LxrPoWData
+// Computes LxrPoW over input of any length, absorbed with Absorb.  Even a 32 byte
+// input is absorbed, so it is not LxrPoW of the input.  To test many nonces,
+// Absorb the input once and use LxrPoW or LxrPoWBatch on the result.
+func (lx LxrPow) LxrPoWData(input []byte, nonce uint64) (pow uint64) {
+	hash := Absorb(input)
+	return lx.LxrPoW(hash[:], nonce)
+}
+
+// VerifyData
+// Reports if the claimed proof of work is the proof of work of the input, absorbed
+// with Absorb, and nonce.
+func (lx LxrPow) VerifyData(input []byte, nonce, claimedPow uint64) bool {
+	hash := Absorb(input)
+	return lx.Verify(hash[:], nonce, claimedPow)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"testing"
+)
+
+func TestAbsorb(t *testing.T) {
+	// Every input is the domain separated, length prefixed SHA-256, 32 bytes included
+	seen := map[[32]byte]int{}
+	for _, length := range []int{0, 1, 31, 32, 33, 48, 64, 80, 1000} {
+		input := make([]byte, length)
+		var prefix [8]byte
+		binary.BigEndian.PutUint64(prefix[:], uint64(length))
+		want := sha256.Sum256(append(append([]byte(AbsorbDomain), prefix[:]...), input...))
+		got := Absorb(input)
+		if got != want {
+			t.Errorf("%d bytes absorbed to %x, expected %x", length, got, want)
+		}
+		if other, dup := seen[got]; dup {
+			t.Errorf("%d and %d zero bytes absorb to the same hash", length, other)
+		}
+		seen[got] = length
+	}
+
+	// A 32 byte preimage is told apart from a 32 byte digest of the same bytes, and
+	// absorbing again gives another hash
+	digest := sha256.Sum256([]byte("header"))
+	absorbed := Absorb(digest[:])
+	if absorbed == digest {
+		t.Error("a 32 byte input must not absorb to itself")
+	}
+	if Absorb(absorbed[:]) == absorbed {
+		t.Error("absorbing an absorbed hash must not return it")
+	}
+
+	// Absorb must not modify its input
+	input := sha512.Sum512([]byte("header"))
+	before := input
+	Absorb(input[:])
+	if input != before {
+		t.Error("Absorb modified its input")
+	}
+}
+
+func TestLxrPoWData(t *testing.T) {
+	lx, err := New(Options{Loops: 16, Bits: 10, Passes: 6, Store: NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+
+	// A 32 byte preimage is absorbed like any other input; only LxrPoW mines it as is
+	preimage := sha256.Sum256([]byte("header"))
+	hash := Absorb(preimage[:])
+	if lx.LxrPoWData(preimage[:], 7) != lx.LxrPoW(hash[:], 7) {
+		t.Error("LxrPoWData of 32 bytes must be LxrPoW of the absorbed input")
+	}
+	sha384 := sha512.Sum384([]byte("header"))
+	absorbed := Absorb(sha384[:])
+	pow := lx.LxrPoWData(sha384[:], 7)
+	if pow != lx.LxrPoW(absorbed[:], 7) {
+		t.Error("LxrPoWData must be LxrPoW of the absorbed input")
+	}
+	if !lx.VerifyData(sha384[:], 7, pow) || lx.VerifyData(sha384[:], 7, pow+1) {
+		t.Error("VerifyData is wrong")
+	}
+	lx.LxrPoWData(nil, 1) // Must not panic
+}
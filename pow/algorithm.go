@@ -0,0 +1,110 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"fmt"
+	"sync"
+)
+
+// AlgorithmID identifies a family of PoW algorithms
+type AlgorithmID uint16
+
+const (
+	AlgorithmLxrPoW AlgorithmID = 1 // LxrPoW; the version is the ByteMap generator version
+)
+
+// AlgorithmKey
+// Everything that defines a PoW space.  Two instances with the same key always
+// compute the same PoW; any change to the key maps the PoW to a different space.
+type AlgorithmKey struct {
+	ID      AlgorithmID // The family of the algorithm
+	Version uint16      // Version of the algorithm within its family
+	Loops   int         // The number of loops translating the ByteMap
+	Bits    int         // Number of bits used to create the ByteMap
+	Passes  int         // Number of shuffles used to randomize the ByteMap
+}
+
+func (k AlgorithmKey) String() string {
+	return fmt.Sprintf("algorithm=%d version=%d loops=%d bits=%d passes=%d", k.ID, k.Version, k.Loops, k.Bits, k.Passes)
+}
+
+// Algorithm
+// A PoW function.  Hashers use Meets to test nonces, and validators use Verify
+// to check the PoW claimed by submissions.
+type Algorithm interface {
+	Key() AlgorithmKey                                            // The key the algorithm was built with
+	PoW(hash []byte, nonce uint64) (pow uint64, err error)        // The PoW of the hash and nonce
+	Meets(hash []byte, nonce, limit uint64) (pow uint64, ok bool) // The PoW, and if it is greater than limit
+	Verify(hash []byte, nonce, claimedPow uint64) bool            // True if claimedPow is the PoW of hash and nonce
+	Close() error                                                 // Releases the resources of the algorithm
+}
+
+// AlgorithmFactory builds the algorithm for a key.  Only the key decides the PoW
+// space; the options say where tables are cached, how to log, and so on.  The
+// Loops, Bits, Passes and Generator in the options are ignored.
+type AlgorithmFactory func(key AlgorithmKey, opts Options) (Algorithm, error)
+
+var algorithmsMutex sync.RWMutex
+var algorithms = map[AlgorithmID]AlgorithmFactory{}
+
+func init() {
+	RegisterAlgorithm(AlgorithmLxrPoW, newLxrPoWAlgorithm)
+}
+
+// RegisterAlgorithm
+// Makes an algorithm family available by its ID.  Panics if the ID is already registered.
+func RegisterAlgorithm(id AlgorithmID, factory AlgorithmFactory) {
+	algorithmsMutex.Lock()
+	defer algorithmsMutex.Unlock()
+	if _, exists := algorithms[id]; exists {
+		panic(fmt.Sprintf("algorithm %d is already registered", id))
+	}
+	algorithms[id] = factory
+}
+
+// NewAlgorithm
+// Builds the algorithm for the key using the factory registered for its ID
+func NewAlgorithm(key AlgorithmKey, opts Options) (Algorithm, error) {
+	algorithmsMutex.RLock()
+	factory, ok := algorithms[key.ID]
+	algorithmsMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownAlgorithm, key.ID)
+	}
+	return factory(key, opts)
+}
+
+// newLxrPoWAlgorithm builds an LxrPow for the key.  The version of the key is the
+// version of the ByteMap generator.
+func newLxrPoWAlgorithm(key AlgorithmKey, opts Options) (Algorithm, error) {
+	opts.Loops, opts.Bits, opts.Passes = key.Loops, key.Bits, key.Passes
+	opts.Generator = GeneratorVersion(key.Version)
+	if opts.Generator == 0 {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownGenerator, key.Version)
+	}
+	lx, err := New(opts)
+	if err != nil {
+		return nil, err
+	}
+	return lx, nil
+}
+
+var _ Algorithm = (*LxrPow)(nil)
+
+// Key
+// Returns the key of the PoW space of the LxrPow
+func (lx *LxrPow) Key() AlgorithmKey {
+	return AlgorithmKey{
+		ID:      AlgorithmLxrPoW,
+		Version: uint16(lx.generator()),
+		Loops:   lx.Loops,
+		Bits:    lx.Bits(),
+		Passes:  lx.Passes,
+	}
+}
+
+// Meets is LxrPoWMeets, so the LxrPow is an Algorithm
+func (lx *LxrPow) Meets(hash []byte, nonce, limit uint64) (pow uint64, ok bool) {
+	return lx.LxrPoWMeets(hash, nonce, limit)
+}
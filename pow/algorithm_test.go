@@ -0,0 +1,113 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestNewAlgorithm(t *testing.T) {
+	store := NewMemStore()
+	key := AlgorithmKey{ID: AlgorithmLxrPoW, Version: uint16(GeneratorLegacy), Loops: 16, Bits: 12, Passes: 6}
+	alg, err := NewAlgorithm(key, Options{Store: store, Loops: 99, Bits: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alg.Close()
+	if alg.Key() != key {
+		t.Errorf("key is %v, expected %v", alg.Key(), key)
+	}
+
+	// The algorithm must compute exactly what an LxrPow built from the same parameters does
+	lx, err := New(Options{Loops: 16, Bits: 12, Passes: 6, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	hash := sha256.Sum256([]byte("algorithm"))
+	for nonce := uint64(0); nonce < 100; nonce++ {
+		pow, err := alg.PoW(hash[:], nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := lx.LxrPoW(hash[:], nonce); pow != want {
+			t.Fatalf("nonce %d: PoW %x, expected %x", nonce, pow, want)
+		}
+		if p, ok := alg.Meets(hash[:], nonce, pow-1); !ok || p != pow {
+			t.Errorf("nonce %d: PoW %x does not meet %x", nonce, pow, pow-1)
+		}
+		if !alg.Verify(hash[:], nonce, pow) || alg.Verify(hash[:], nonce, pow+1) {
+			t.Errorf("nonce %d: Verify is wrong", nonce)
+		}
+	}
+
+	// The version selects the generator, so it selects a different PoW space
+	key.Version = uint16(GeneratorParallel)
+	parallel, err := NewAlgorithm(key, Options{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parallel.Close()
+	if parallel.Key() != key {
+		t.Errorf("key is %v, expected %v", parallel.Key(), key)
+	}
+	if a, b := alg.(*LxrPow).LxrPoW(hash[:], 1), parallel.(*LxrPow).LxrPoW(hash[:], 1); a == b {
+		t.Error("versions 1 and 2 compute the same PoW")
+	}
+}
+
+func TestNewAlgorithm_Errors(t *testing.T) {
+	store := NewMemStore()
+	tests := []struct {
+		name string
+		key  AlgorithmKey
+		want error
+	}{
+		{"unknown id", AlgorithmKey{ID: 999, Version: 1, Bits: 8}, ErrUnknownAlgorithm},
+		{"no id", AlgorithmKey{Version: 1, Bits: 8}, ErrUnknownAlgorithm},
+		{"no version", AlgorithmKey{ID: AlgorithmLxrPoW, Bits: 8}, ErrUnknownGenerator},
+		{"unknown version", AlgorithmKey{ID: AlgorithmLxrPoW, Version: 999, Bits: 8}, ErrUnknownGenerator},
+		{"bits", AlgorithmKey{ID: AlgorithmLxrPoW, Version: 1, Bits: 33}, ErrBitsOutOfRange},
+	}
+	for _, tt := range tests {
+		if _, err := NewAlgorithm(tt.key, Options{Store: store}); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, expected %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+type constAlgorithm struct{ key AlgorithmKey }
+
+func (a constAlgorithm) Key() AlgorithmKey                             { return a.key }
+func (a constAlgorithm) PoW(hash []byte, nonce uint64) (uint64, error) { return nonce, nil }
+func (a constAlgorithm) Meets(hash []byte, nonce, limit uint64) (uint64, bool) {
+	return nonce, nonce > limit
+}
+func (a constAlgorithm) Verify(hash []byte, nonce, claimedPow uint64) bool {
+	return nonce == claimedPow
+}
+func (a constAlgorithm) Close() error { return nil }
+
+func TestRegisterAlgorithm(t *testing.T) {
+	const id AlgorithmID = 0xFFFE
+	RegisterAlgorithm(id, func(key AlgorithmKey, opts Options) (Algorithm, error) {
+		return constAlgorithm{key}, nil
+	})
+	key := AlgorithmKey{ID: id, Version: 3, Loops: 1}
+	alg, err := NewAlgorithm(key, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alg.Key() != key {
+		t.Errorf("key is %v, expected %v", alg.Key(), key)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering an algorithm twice must panic")
+		}
+	}()
+	RegisterAlgorithm(AlgorithmLxrPoW, newLxrPoWAlgorithm)
+}
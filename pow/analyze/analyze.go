@@ -0,0 +1,272 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+// Package analyze measures the statistical quality of ByteMaps and of the PoW
+// computed with them, so choices of Bits, Passes and generator can be justified
+// with numbers.
+//
+// A report covers four things:
+//
+//   - The histogram of byte values in the ByteMap.  Generators keep every byte
+//     value equally common, so the chi-square should be exactly 0.
+//   - The cycles of the walk i -> (i<<8 | ByteMap[i]) mod MapSize, which reads a
+//     byte and shifts it into the address like the LxrPoW state does.  For 8 bits
+//     the walk is a permutation of the ByteMap.  A well mixed ByteMap has cycles
+//     like those of a random mapping, about sqrt(pi*N/2) nodes on cycles.
+//   - The serial correlation of bytes at several lags, which should be near 0.
+//   - How uniform LxrPoW output is over a sample of hashes and nonces.
+package analyze
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"math/bits"
+
+	"github.com/pegnet/LXRPow/pow"
+)
+
+// Config
+// What an analysis covers
+type Config struct {
+	Samples   int   // LxrPoW outputs sampled for uniformity; 0 uses DefaultSamples
+	CycleBits int   // Largest Bits for which cycles are found (4 bytes of memory per ByteMap byte); 0 uses DefaultCycleBits
+	Lags      []int // Lags of the serial correlation; nil uses DefaultLags
+}
+
+// DefaultSamples is the number of LxrPoW outputs sampled for uniformity
+const DefaultSamples = 100000
+
+// DefaultCycleBits bounds the memory used to find cycles to 256 MB
+const DefaultCycleBits = 26
+
+// DefaultLags are the lags the serial correlation is measured at
+var DefaultLags = []int{1, 2, 3, 8, 64, 256}
+
+// Histogram
+// The count of each byte value in a ByteMap
+type Histogram struct {
+	Counts    [256]uint64 `json:"counts"`
+	Expected  float64     `json:"expected"`  // Count of each value if all are equally common
+	ChiSquare float64     `json:"chiSquare"` // Chi-square against equal counts, 255 degrees of freedom
+	Min       uint64      `json:"min"`       // Smallest count
+	Max       uint64      `json:"max"`       // Largest count
+	Balanced  bool        `json:"balanced"`  // Every value is exactly equally common
+}
+
+// CycleReport
+// The cycles of the walk i -> (i<<8 | ByteMap[i]) mod MapSize
+type CycleReport struct {
+	Nodes          uint64   `json:"nodes"`          // Size of the ByteMap
+	Cycles         uint64   `json:"cycles"`         // Number of distinct cycles
+	CyclicNodes    uint64   `json:"cyclicNodes"`    // Nodes that lie on a cycle
+	Longest        uint64   `json:"longest"`        // Length of the longest cycle
+	Mean           float64  `json:"mean"`           // Mean cycle length
+	Buckets        []uint64 `json:"buckets"`        // Buckets[k] counts cycles of length 2^k to 2^(k+1)-1
+	ExpectedCyclic float64  `json:"expectedCyclic"` // Nodes on cycles expected of a random mapping, sqrt(pi*N/2)
+	ExpectedCycles float64  `json:"expectedCycles"` // Cycles expected of a random mapping, ln(2N)/2 + 0.29
+}
+
+// Correlation
+// The serial correlation of the bytes of the ByteMap at a lag
+type Correlation struct {
+	Lag         int     `json:"lag"`
+	Coefficient float64 `json:"coefficient"` // Pearson correlation of ByteMap[i] and ByteMap[i+Lag], wrapping around
+}
+
+// LeadingOnes
+// How many PoW values had at least Bits leading one bits
+type LeadingOnes struct {
+	Bits     int     `json:"bits"`
+	Observed uint64  `json:"observed"`
+	Expected float64 `json:"expected"`
+}
+
+// Uniformity
+// How uniform LxrPoW output is over a sample
+type Uniformity struct {
+	Samples          int           `json:"samples"`
+	TopByteChiSquare float64       `json:"topByteChiSquare"` // Chi-square of the top byte against equal counts, 255 degrees of freedom
+	TopByteZ         float64       `json:"topByteZ"`         // Chi-square as a standard normal deviate; |Z| over 3 is suspect
+	BitBias          float64       `json:"bitBias"`          // Largest deviation from 1/2 of the frequency of ones of any bit
+	BitBiasZ         float64       `json:"bitBiasZ"`         // BitBias in standard deviations; over 4 is suspect for 64 bits
+	LeadingOnes      []LeadingOnes `json:"leadingOnes"`
+}
+
+// Report
+// Everything measured about one LxrPow
+type Report struct {
+	Loops       int           `json:"loops"`
+	Bits        int           `json:"bits"`
+	Passes      int           `json:"passes"`
+	Generator   uint16        `json:"generator"`
+	Histogram   Histogram     `json:"histogram"`
+	Cycles      *CycleReport  `json:"cycles,omitempty"` // nil if Bits is over the CycleBits of the Config
+	Correlation []Correlation `json:"serialCorrelation"`
+	Uniformity  Uniformity    `json:"uniformity"`
+}
+
+// Analyze
+// Measures the ByteMap of the LxrPow and the uniformity of its PoW
+func Analyze(lx *pow.LxrPow, cfg Config) Report {
+	if cfg.CycleBits <= 0 {
+		cfg.CycleBits = DefaultCycleBits
+	}
+	if cfg.Lags == nil {
+		cfg.Lags = DefaultLags
+	}
+	key := lx.Key()
+	r := Report{Loops: key.Loops, Bits: key.Bits, Passes: key.Passes, Generator: key.Version}
+	r.Histogram = ByteHistogram(lx.ByteMap)
+	if r.Bits <= cfg.CycleBits {
+		cycles := CycleLengths(lx.ByteMap)
+		r.Cycles = &cycles
+	}
+	for _, lag := range cfg.Lags {
+		r.Correlation = append(r.Correlation, Correlation{Lag: lag, Coefficient: SerialCorrelation(lx.ByteMap, lag)})
+	}
+	r.Uniformity = PoWUniformity(lx, cfg.Samples)
+	return r
+}
+
+// ByteHistogram counts each byte value in the ByteMap
+func ByteHistogram(byteMap []byte) (h Histogram) {
+	for _, b := range byteMap {
+		h.Counts[b]++
+	}
+	h.Expected = float64(len(byteMap)) / 256
+	h.ChiSquare = chiSquare(h.Counts[:], h.Expected)
+	h.Min, h.Max = h.Counts[0], h.Counts[0]
+	for _, c := range h.Counts {
+		h.Min, h.Max = min(h.Min, c), max(h.Max, c)
+	}
+	h.Balanced = h.Min == h.Max
+	return h
+}
+
+// CycleLengths
+// Finds the cycles of the walk i -> (i<<8 | ByteMap[i]) mod len(ByteMap).  The
+// length of the ByteMap must be a power of 2 no larger than 2^32.
+func CycleLengths(byteMap []byte) (r CycleReport) {
+	n := uint64(len(byteMap))
+	mask := n - 1
+	r.Nodes = n
+	r.ExpectedCyclic = math.Sqrt(math.Pi * float64(n) / 2)
+	r.ExpectedCycles = math.Log(2*float64(n))/2 + 0.29
+	next := func(i uint64) uint64 { return (i<<8 | uint64(byteMap[i])) & mask }
+
+	// Every node is marked with the walk that first reached it.  A walk that
+	// reaches its own mark has found a new cycle; one that reaches another walk's
+	// mark has joined a tree leading to a cycle already counted.
+	walks := make([]uint32, n)
+	var walk uint32
+	for start := uint64(0); start < n; start++ {
+		if walks[start] != 0 {
+			continue
+		}
+		walk++
+		i := start
+		for walks[i] == 0 {
+			walks[i] = walk
+			i = next(i)
+		}
+		if walks[i] != walk {
+			continue
+		}
+		length := uint64(1)
+		for j := next(i); j != i; j = next(j) {
+			length++
+		}
+		r.Cycles++
+		r.CyclicNodes += length
+		r.Longest = max(r.Longest, length)
+		bucket := bits.Len64(length) - 1
+		for len(r.Buckets) <= bucket {
+			r.Buckets = append(r.Buckets, 0)
+		}
+		r.Buckets[bucket]++
+	}
+	if r.Cycles > 0 {
+		r.Mean = float64(r.CyclicNodes) / float64(r.Cycles)
+	}
+	return r
+}
+
+// SerialCorrelation
+// Returns the Pearson correlation of ByteMap[i] and ByteMap[i+lag], wrapping
+// around the end of the ByteMap.  Values near 0 mean no correlation.
+func SerialCorrelation(byteMap []byte, lag int) float64 {
+	n := len(byteMap)
+	if n == 0 {
+		return 0
+	}
+	var sum, sumSq, sumProd uint64 // Exact; a 4 GB ByteMap sums to well under 2^64
+	for i, b := range byteMap {
+		x := uint64(b)
+		sum += x
+		sumSq += x * x
+		sumProd += x * uint64(byteMap[(i+lag)%n])
+	}
+	// Both series are the same bytes, so they have the same mean and variance
+	fn := float64(n)
+	mean := float64(sum) / fn
+	variance := float64(sumSq)/fn - mean*mean
+	if variance == 0 {
+		return 0
+	}
+	return (float64(sumProd)/fn - mean*mean) / variance
+}
+
+// PoWUniformity
+// Samples LxrPoW over pseudo random hashes and nonces, and measures how uniform
+// the output is
+func PoWUniformity(lx *pow.LxrPow, samples int) (u Uniformity) {
+	if samples <= 0 {
+		samples = DefaultSamples
+	}
+	u.Samples = samples
+	var topBytes [256]uint64
+	var ones [64]uint64
+	var leading [17]uint64
+
+	seed := sha256.Sum256([]byte("lxrpow analyze"))
+	for i := 0; i < samples; i++ {
+		var in [40]byte
+		copy(in[:], seed[:])
+		binary.BigEndian.PutUint64(in[32:], uint64(i))
+		hash := sha256.Sum256(in[:])
+		p := lx.LxrPoW(hash[:], binary.BigEndian.Uint64(hash[24:]))
+
+		topBytes[p>>56]++
+		for b := 0; b < 64; b++ {
+			ones[b] += p >> b & 1
+		}
+		for k := 0; k <= min(bits.LeadingZeros64(^p), 16); k++ {
+			leading[k]++
+		}
+	}
+
+	fs := float64(samples)
+	u.TopByteChiSquare = chiSquare(topBytes[:], fs/256)
+	u.TopByteZ = (u.TopByteChiSquare - 255) / math.Sqrt(2*255)
+	for _, c := range ones {
+		u.BitBias = max(u.BitBias, math.Abs(float64(c)/fs-0.5))
+	}
+	u.BitBiasZ = u.BitBias / math.Sqrt(0.25/fs)
+	for k := 1; k < len(leading); k++ {
+		u.LeadingOnes = append(u.LeadingOnes, LeadingOnes{Bits: k, Observed: leading[k], Expected: fs / float64(uint64(1)<<k)})
+	}
+	return u
+}
+
+// chiSquare returns the chi-square of the counts against the expected count
+func chiSquare(counts []uint64, expected float64) (chi float64) {
+	if expected == 0 {
+		return 0
+	}
+	for _, c := range counts {
+		d := float64(c) - expected
+		chi += d * d / expected
+	}
+	return chi
+}
@@ -0,0 +1,98 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package analyze
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pegnet/LXRPow/pow"
+)
+
+func TestAnalyze(t *testing.T) {
+	lx, err := pow.New(pow.Options{Loops: 16, Bits: 16, Passes: 6, Store: pow.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	r := Analyze(lx, Config{Samples: 20000})
+	if r.Bits != 16 || r.Loops != 16 || r.Passes != 6 {
+		t.Errorf("wrong parameters reported: %+v", r)
+	}
+	if !r.Histogram.Balanced || r.Histogram.ChiSquare != 0 || r.Histogram.Min != 256 {
+		t.Errorf("generated ByteMap is not balanced: %+v", r.Histogram)
+	}
+	if r.Cycles == nil || r.Cycles.Cycles == 0 {
+		t.Fatalf("no cycles found: %+v", r.Cycles)
+	}
+	if len(r.Correlation) != len(DefaultLags) {
+		t.Fatalf("expected %d correlations, got %d", len(DefaultLags), len(r.Correlation))
+	}
+	for _, c := range r.Correlation {
+		if math.Abs(c.Coefficient) > .05 {
+			t.Errorf("lag %d is correlated: %f", c.Lag, c.Coefficient)
+		}
+	}
+	u := r.Uniformity
+	if u.Samples != 20000 || math.Abs(u.TopByteZ) > 5 || u.BitBiasZ > 5 {
+		t.Errorf("LxrPoW output is not uniform: %+v", u)
+	}
+	if l := u.LeadingOnes[0]; l.Bits != 1 || math.Abs(float64(l.Observed)-l.Expected) > 5*math.Sqrt(l.Expected) {
+		t.Errorf("wrong count of leading ones: %+v", l)
+	}
+
+	if r := Analyze(lx, Config{Samples: 10, CycleBits: 12}); r.Cycles != nil {
+		t.Error("cycles found for a ByteMap over CycleBits")
+	}
+}
+
+func TestByteHistogram(t *testing.T) {
+	h := ByteHistogram([]byte{0, 0, 1, 255})
+	if h.Counts[0] != 2 || h.Counts[1] != 1 || h.Counts[255] != 1 || h.Min != 0 || h.Max != 2 || h.Balanced {
+		t.Errorf("wrong histogram: %+v", h)
+	}
+	if h.ChiSquare <= 0 {
+		t.Errorf("expected a positive chi-square, got %f", h.ChiSquare)
+	}
+}
+
+func TestCycleLengths(t *testing.T) {
+	// For 256 bytes the walk is i -> ByteMap[i].  This ByteMap swaps pairs, except
+	// 0 and 1, which map to themselves: 2 cycles of 1 and 127 cycles of 2.
+	byteMap := make([]byte, 256)
+	for i := range byteMap {
+		byteMap[i] = byte(i ^ 1)
+	}
+	byteMap[0], byteMap[1] = 0, 1
+	r := CycleLengths(byteMap)
+	if r.Cycles != 129 || r.CyclicNodes != 256 || r.Longest != 2 {
+		t.Errorf("wrong cycles: %+v", r)
+	}
+	if len(r.Buckets) != 2 || r.Buckets[0] != 2 || r.Buckets[1] != 127 {
+		t.Errorf("wrong buckets: %v", r.Buckets)
+	}
+
+	// One cycle through every node
+	for i := range byteMap {
+		byteMap[i] = byte(i + 1)
+	}
+	if r := CycleLengths(byteMap); r.Cycles != 1 || r.Longest != 256 || r.Mean != 256 {
+		t.Errorf("wrong cycles: %+v", r)
+	}
+}
+
+func TestSerialCorrelation(t *testing.T) {
+	ramp := make([]byte, 256)
+	for i := range ramp {
+		ramp[i] = byte(i)
+	}
+	if c := SerialCorrelation(ramp, 0); math.Abs(c-1) > 1e-9 {
+		t.Errorf("a series is perfectly correlated with itself, got %f", c)
+	}
+	if c := SerialCorrelation(ramp, 1); c < .9 {
+		t.Errorf("a ramp is strongly correlated at lag 1, got %f", c)
+	}
+	if c := SerialCorrelation(make([]byte, 16), 1); c != 0 {
+		t.Errorf("a constant series has no correlation, got %f", c)
+	}
+}
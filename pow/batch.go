@@ -0,0 +1,101 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"fmt"
+)
+
+// batchLanes is the number of independent state chains interleaved by the batch
+// functions.  Each translation through the ByteMap is a likely cache miss; running
+// several chains at once lets the CPU wait on several misses at the same time.
+const batchLanes = 4
+
+// LxrPoWBatch
+// Computes LxrPoW(hash, nonces[i]) into out[i] for every nonce.  The results are
+// identical to calling LxrPoW for each nonce, but several nonces are computed at
+// once to hide the latency of the ByteMap lookups.
+//
+// LxrPoWBatch panics if the hash is not 32 bytes long, or out is shorter than
+// nonces; use PoWBatch to get an error instead.
+func (lx LxrPow) LxrPoWBatch(hash []byte, nonces []uint64, out []uint64) {
+	if err := lx.PoWBatch(hash, nonces, out); err != nil {
+		panic(err)
+	}
+}
+
+// PoWBatch is LxrPoWBatch, returning an error rather than panicking
+func (lx LxrPow) PoWBatch(hash []byte, nonces []uint64, out []uint64) error {
+	return lx.batch(func(int) []byte { return hash }, nonces, out)
+}
+
+// LxrPoWMulti
+// Computes LxrPoW(hashes[i], nonces[i]) into out[i] for every pair, interleaving
+// the computations like LxrPoWBatch.
+//
+// LxrPoWMulti panics if any hash is not 32 bytes long, or the slices are not all
+// the same length; use PoWMulti to get an error instead.
+func (lx LxrPow) LxrPoWMulti(hashes [][]byte, nonces []uint64, out []uint64) {
+	if err := lx.PoWMulti(hashes, nonces, out); err != nil {
+		panic(err)
+	}
+}
+
+// PoWMulti is LxrPoWMulti, returning an error rather than panicking
+func (lx LxrPow) PoWMulti(hashes [][]byte, nonces []uint64, out []uint64) error {
+	if len(hashes) != len(nonces) {
+		return fmt.Errorf("%d hashes for %d nonces", len(hashes), len(nonces))
+	}
+	return lx.batch(func(i int) []byte { return hashes[i] }, nonces, out)
+}
+
+// batch computes the PoW of every (hashAt(i), nonces[i]) pair, batchLanes at a time
+func (lx LxrPow) batch(hashAt func(i int) []byte, nonces []uint64, out []uint64) (err error) {
+	if len(out) < len(nonces) {
+		return fmt.Errorf("%d results will not fit in %d outputs", len(nonces), len(out))
+	}
+	mask := lx.MapSize - 1
+	byteMap := lx.ByteMap
+
+	i := 0
+	for ; i+batchLanes <= len(nonces); i += batchLanes {
+		var h0, h1, h2, h3 [40]byte
+		var s0, s1, s2, s3 uint64
+		if h0, s0, err = lx.mix(hashAt(i), nonces[i]); err != nil {
+			return err
+		}
+		if h1, s1, err = lx.mix(hashAt(i+1), nonces[i+1]); err != nil {
+			return err
+		}
+		if h2, s2, err = lx.mix(hashAt(i+2), nonces[i+2]); err != nil {
+			return err
+		}
+		if h3, s3, err = lx.mix(hashAt(i+3), nonces[i+3]); err != nil {
+			return err
+		}
+
+		// Exactly the loops of LxrPoW, for four chains at once
+		for l := 0; l < lx.Loops; l++ {
+			for j := range h0 {
+				s0 = s0<<17 ^ s0>>7 ^ uint64(byteMap[s0&mask]^h0[j])
+				s1 = s1<<17 ^ s1>>7 ^ uint64(byteMap[s1&mask]^h1[j])
+				s2 = s2<<17 ^ s2>>7 ^ uint64(byteMap[s2&mask]^h2[j])
+				s3 = s3<<17 ^ s3>>7 ^ uint64(byteMap[s3&mask]^h3[j])
+				h0[j], h1[j], h2[j], h3[j] = byte(s0), byte(s1), byte(s2), byte(s3)
+			}
+		}
+
+		out[i] = mixState(hashAt(i), s0)
+		out[i+1] = mixState(hashAt(i+1), s1)
+		out[i+2] = mixState(hashAt(i+2), s2)
+		out[i+3] = mixState(hashAt(i+3), s3)
+	}
+
+	// Whatever doesn't fill all the lanes is done one at a time
+	for ; i < len(nonces); i++ {
+		if out[i], err = lx.PoW(hashAt(i), nonces[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// TestBatch_Differential checks the batch functions give exactly the results of LxrPoW
+func TestBatch_Differential(t *testing.T) {
+	store := NewMemStore()
+	r := rand.New(rand.NewSource(1))
+	for _, bits := range []int{8, 12, 16} {
+		for _, loops := range []int{0, 1, 5, 16} {
+			lx, err := New(Options{Loops: loops, Bits: bits, Passes: 6, Store: store})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, n := range []int{0, 1, 3, 4, 5, 17, 100} {
+				hash := sha256.Sum256([]byte{byte(bits), byte(loops), byte(n)})
+				nonces := make([]uint64, n)
+				hashes := make([][]byte, n)
+				for i := range nonces {
+					nonces[i] = r.Uint64()
+					h := sha256.Sum256(hash[:])
+					hash = h
+					hashes[i] = h[:]
+				}
+
+				out := make([]uint64, n)
+				lx.LxrPoWBatch(hash[:], nonces, out)
+				for i, nonce := range nonces {
+					if want := lx.LxrPoW(hash[:], nonce); out[i] != want {
+						t.Fatalf("bits %d loops %d: batch[%d] = %016x, LxrPoW = %016x", bits, loops, i, out[i], want)
+					}
+				}
+
+				lx.LxrPoWMulti(hashes, nonces, out)
+				for i, nonce := range nonces {
+					if want := lx.LxrPoW(hashes[i], nonce); out[i] != want {
+						t.Fatalf("bits %d loops %d: multi[%d] = %016x, LxrPoW = %016x", bits, loops, i, out[i], want)
+					}
+				}
+			}
+			lx.Close()
+		}
+	}
+}
+
+func TestBatch_Errors(t *testing.T) {
+	lx, err := New(Options{Loops: 4, Bits: 8, Passes: 6, Store: NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	nonces := []uint64{1, 2, 3, 4, 5}
+	if err := lx.PoWBatch(make([]byte, 20), nonces, make([]uint64, 5)); !errors.Is(err, ErrHashLength) {
+		t.Errorf("expected ErrHashLength, got %v", err)
+	}
+	if err := lx.PoWBatch(make([]byte, 32), nonces, make([]uint64, 4)); err == nil {
+		t.Error("expected an error when out is too short")
+	}
+	if err := lx.PoWMulti(make([][]byte, 4), nonces, make([]uint64, 5)); err == nil {
+		t.Error("expected an error when hashes and nonces differ in length")
+	}
+}
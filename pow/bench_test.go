@@ -0,0 +1,75 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+// benchStore keeps the ByteMaps built by the benchmarks, so each is only generated once
+var benchStore = NewMemStore()
+
+func benchLxrPow(b *testing.B, loops, bits int) *LxrPow {
+	b.Helper()
+	lx, err := New(Options{Loops: loops, Bits: bits, Passes: 6, Store: benchStore})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return lx
+}
+
+func BenchmarkLxrPoW(b *testing.B) {
+	hash := sha256.Sum256([]byte("benchmark"))
+	for _, bits := range []int{12, 16, 20, 24} {
+		for _, loops := range []int{16, 32, 50} {
+			b.Run(fmt.Sprintf("bits=%d/loops=%d", bits, loops), func(b *testing.B) {
+				lx := benchLxrPow(b, loops, bits)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					lx.LxrPoW(hash[:], uint64(i))
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkLxrPoWBatch(b *testing.B) {
+	hash := sha256.Sum256([]byte("benchmark"))
+	nonces := make([]uint64, 64)
+	out := make([]uint64, len(nonces))
+	for _, bits := range []int{16, 24} {
+		b.Run(fmt.Sprintf("bits=%d/loops=16", bits), func(b *testing.B) {
+			lx := benchLxrPow(b, 16, bits)
+			b.ResetTimer()
+			for i := 0; i < b.N; i += len(nonces) {
+				for j := range nonces {
+					nonces[j] = uint64(i + j)
+				}
+				lx.LxrPoWBatch(hash[:], nonces, out)
+			}
+		})
+	}
+}
+
+func BenchmarkMix(b *testing.B) {
+	hash := sha256.Sum256([]byte("benchmark"))
+	for i := 0; i < b.N; i++ {
+		Mix(hash[:], uint64(i))
+	}
+}
+
+func BenchmarkGenerateTable(b *testing.B) {
+	for _, version := range []GeneratorVersion{GeneratorLegacy, GeneratorParallel} {
+		for _, bits := range []int{12, 16, 20} {
+			b.Run(fmt.Sprintf("generator=%d/bits=%d", version, bits), func(b *testing.B) {
+				lx := &LxrPow{MapSize: 1 << bits, Passes: 6, Generator: version}
+				b.SetBytes(int64(lx.MapSize))
+				for i := 0; i < b.N; i++ {
+					lx.GenerateTable()
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+)
+
+// tableKey identifies a ByteMap, and how it was loaded.  Loops is not part of it,
+// since it does not change the ByteMap.  Mapped and heap copies are not shared, nor
+// are copies loaded without checking their SHA-256 shared with those that check.
+// Tables are only shared between instances using the same store, so each store
+// is read, checked and written by the instances using it.
+type tableKey struct {
+	bits      int
+	passes    int
+	generator GeneratorVersion
+	mmap      bool
+	trusted   bool
+	store     any // Identifies the store; see storeID
+}
+
+// dirStoreID identifies a DirStore by the directory it keeps tables in
+type dirStoreID string
+
+// storeID
+// Returns the identity of a store in a tableKey.  DirStores on the same directory
+// are the same store; any other store is itself.  Stores that can't be compared
+// get an identity of their own, so their tables are never shared.
+func storeID(store TableStore) any {
+	if d, ok := store.(*DirStore); ok {
+		if root, err := filepath.Abs(d.Root); err == nil {
+			return dirStoreID(root)
+		}
+		return dirStoreID(filepath.Clean(d.Root))
+	}
+	if store == nil || !reflect.TypeOf(store).Comparable() {
+		return new(byte)
+	}
+	return store
+}
+
+// sharedTable is a ByteMap shared by every LxrPow in the process built with the same key
+type sharedTable struct {
+	ready   chan struct{} // Closed once the table is loaded, or failed to load
+	err     error         // Why the table failed to load
+	refs    int           // LxrPow instances using the table
+	byteMap []byte
+	table   []byte
+	unmap   func() error // Releases the table if it is memory mapped
+}
+
+var tablesMutex sync.Mutex
+var tables = map[tableKey]*sharedTable{}
+
+// acquireTable
+// Points the LxrPow at the process wide copy of its ByteMap, loading it from the
+// store if no other LxrPow is using it.  The ByteMap is shared, so it must not be
+// modified.  Close releases the LxrPow's reference; the memory is released when the
+// last LxrPow using the table is closed.
+//
+// If the context is done while waiting for another LxrPow to load the table, the
+// context's error is returned.  If the other LxrPow's context is done first, the
+// table is loaded again under this one's.
+func (lx *LxrPow) acquireTable(ctx context.Context) error {
+	key := tableKey{bits: lx.Bits(), passes: lx.Passes, generator: lx.generator(), mmap: lx.Mmap, trusted: lx.TrustCache,
+		store: storeID(lx.Store)}
+
+	// On failure the LxrPow must not keep a ByteMap that releaseTable has released,
+	// or Close would release it again
+	fail := func(err error) error {
+		lx.ByteMap, lx.table, lx.unmap, lx.owned = nil, nil, nil, false
+		return err
+	}
+	var t *sharedTable
+	for {
+		tablesMutex.Lock()
+		var shared bool
+		t, shared = tables[key]
+		if !shared {
+			t = &sharedTable{ready: make(chan struct{})}
+			tables[key] = t
+		}
+		t.refs++
+		tablesMutex.Unlock()
+
+		if !shared {
+			t.err = lx.LoadTableContext(ctx)
+			t.byteMap, t.table, t.unmap = lx.ByteMap, lx.table, lx.unmap
+			if t.err != nil { // Whoever asks next loads the table afresh
+				tablesMutex.Lock()
+				delete(tables, key)
+				tablesMutex.Unlock()
+			}
+			close(t.ready)
+		} else { // The loader's table is ready, however its context ends
+			select {
+			case <-t.ready:
+			case <-ctx.Done():
+				releaseTable(key, t)
+				return fail(ctx.Err())
+			}
+		}
+		if t.err != nil {
+			releaseTable(key, t)
+			if shared && isContextErr(t.err) && ctx.Err() == nil {
+				continue // Only the loader's context was done
+			}
+			return fail(t.err)
+		}
+		break
+	}
+	lx.ByteMap, lx.table, lx.unmap, lx.owned = t.byteMap, t.table, t.unmap, false
+	var once sync.Once
+	lx.release = func() (err error) {
+		once.Do(func() { err = releaseTable(key, t) })
+		return err
+	}
+	return nil
+}
+
+// isContextErr reports if the error is from a context that was cancelled or timed out
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// releaseTable drops a reference to the table, releasing it if it was the last
+func releaseTable(key tableKey, t *sharedTable) error {
+	tablesMutex.Lock()
+	defer tablesMutex.Unlock()
+	t.refs--
+	if t.refs > 0 {
+		return nil
+	}
+	if tables[key] == t {
+		delete(tables, key)
+	}
+	if t.unmap != nil {
+		return t.unmap()
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countingStore counts the tables loaded from a MemStore
+type countingStore struct {
+	*MemStore
+	loads atomic.Int32
+}
+
+func (s *countingStore) Load(name string) ([]byte, error) {
+	s.loads.Add(1)
+	return s.MemStore.Load(name)
+}
+
+func sharedTables() int {
+	tablesMutex.Lock()
+	defer tablesMutex.Unlock()
+	return len(tables)
+}
+
+func TestSharedTable(t *testing.T) {
+	store := &countingStore{MemStore: NewMemStore()}
+	gen, err := New(Options{Loops: 16, Bits: 14, Passes: 6, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.Close()
+	if n := sharedTables(); n != 0 {
+		t.Fatalf("%d tables still shared after every LxrPow is closed", n)
+	}
+
+	// Instances with the same Bits and Passes share one ByteMap, however many Loops
+	var wg sync.WaitGroup
+	lxs := make([]*LxrPow, 8)
+	for i := range lxs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lx, err := New(Options{Loops: i, Bits: 14, Passes: 6, Store: store})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			lxs[i] = lx
+		}(i)
+	}
+	wg.Wait()
+	if t.Failed() {
+		t.FailNow()
+	}
+	if n := store.loads.Load(); n != 1 {
+		t.Errorf("table was loaded %d times, expected once", n)
+	}
+	for _, lx := range lxs {
+		if &lx.ByteMap[0] != &lxs[0].ByteMap[0] {
+			t.Fatal("instances do not share the ByteMap")
+		}
+	}
+
+	// Different passes are a different ByteMap
+	other, err := New(Options{Loops: 16, Bits: 14, Passes: 5, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &other.ByteMap[0] == &lxs[0].ByteMap[0] {
+		t.Error("different passes share a ByteMap")
+	}
+	other.Close()
+
+	// The table is released once the last instance is closed, and not before
+	for i, lx := range lxs {
+		if err := lx.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := lx.Close(); err != nil { // Closing twice releases once
+			t.Error(err)
+		}
+		if n := sharedTables(); (n == 0) != (i == len(lxs)-1) {
+			t.Fatalf("%d tables shared after closing %d of %d instances", n, i+1, len(lxs))
+		}
+	}
+	lx, err := New(Options{Loops: 16, Bits: 14, Passes: 6, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	if n := store.loads.Load(); n != 2 {
+		t.Errorf("table was loaded %d times, expected twice", n)
+	}
+}
+
+func TestSharedTable_Stores(t *testing.T) {
+	// Each store is read by instances using it, even if another holds the same table
+	first, second := &countingStore{MemStore: NewMemStore()}, &countingStore{MemStore: NewMemStore()}
+	lx1, err := New(Options{Loops: 16, Bits: 13, Passes: 6, Store: first})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx1.Close()
+	lx2, err := New(Options{Loops: 16, Bits: 13, Passes: 6, Store: second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx2.Close()
+	if &lx1.ByteMap[0] == &lx2.ByteMap[0] {
+		t.Error("instances using different stores share a ByteMap")
+	}
+	if !second.Exists(lx2.TableName()) {
+		t.Error("table was not saved to the second store")
+	}
+
+	// DirStores on the same directory are the same store
+	dir := t.TempDir()
+	d1, err := New(Options{Loops: 16, Bits: 13, Passes: 6, Store: &DirStore{Root: dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d1.Close()
+	d2, err := New(Options{Loops: 8, Bits: 13, Passes: 6, TableDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d2.Close()
+	if &d1.ByteMap[0] != &d2.ByteMap[0] {
+		t.Error("instances using the same directory do not share the ByteMap")
+	}
+	if &d1.ByteMap[0] == &lx1.ByteMap[0] {
+		t.Error("a DirStore shares a ByteMap with a MemStore")
+	}
+}
+
+func TestSharedTable_Error(t *testing.T) {
+	store := &failingSaveStore{NewMemStore()}
+	if _, err := New(Options{Loops: 16, Bits: 10, Passes: 6, Store: store}); err == nil {
+		t.Fatal("expected the failed save to be returned")
+	}
+	if n := sharedTables(); n != 0 {
+		t.Errorf("%d tables shared after a failed load", n)
+	}
+}
+
+func TestSharedTable_LoaderCancelled(t *testing.T) {
+	// The loader's context ends as its load succeeds.  Either it keeps the table,
+	// or it returns the error with no ByteMap, so Close does not release it twice.
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		lx := new(LxrPow) // As InitContext does, with a store of its own
+		err := lx.init(ctx, Options{Loops: 16, Bits: 10, Passes: 6,
+			Store: &cancellingStore{MemStore: NewMemStore(), cancel: cancel}})
+		if err != nil && lx.ByteMap != nil {
+			t.Fatalf("load failed with %v, but the ByteMap was kept", err)
+		}
+		if err == nil && len(lx.ByteMap) != 1<<10 {
+			t.Fatal("load succeeded without a ByteMap")
+		}
+		if err := lx.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if n := sharedTables(); n != 0 {
+			t.Fatalf("%d tables shared after every LxrPow is closed", n)
+		}
+	}
+}
+
+// cancellingStore cancels a context once a table is saved
+type cancellingStore struct {
+	*MemStore
+	cancel func()
+}
+
+func (s *cancellingStore) Save(name string, data []byte) error {
+	defer s.cancel()
+	return s.MemStore.Save(name, data)
+}
+
+// failingSaveStore fails to save any table
+type failingSaveStore struct {
+	*MemStore
+}
+
+func (s *failingSaveStore) Save(name string, data []byte) error {
+	return errors.New("save failed")
+}
+
+// blockingGenerator generates the legacy ByteMap once its context is done or
+// proceed is closed, and signals started each time it begins
+type blockingGenerator struct {
+	started chan struct{}
+	proceed chan struct{}
+}
+
+const blockingVersion GeneratorVersion = 0x7f01
+
+var testBlocking = new(blockingGenerator)
+
+func init() {
+	RegisterGenerator(testBlocking)
+}
+
+func (g *blockingGenerator) Version() GeneratorVersion { return blockingVersion }
+
+func (g *blockingGenerator) Generate(byteMap []byte, passes int, progress ProgressFunc) {
+	g.GenerateContext(context.Background(), byteMap, passes, progress)
+}
+
+func (g *blockingGenerator) GenerateContext(ctx context.Context, byteMap []byte, passes int, progress ProgressFunc) error {
+	g.started <- struct{}{}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-g.proceed:
+	}
+	return legacyGenerator{}.GenerateContext(ctx, byteMap, passes, progress)
+}
+
+func TestSharedTable_Context(t *testing.T) {
+	testBlocking.started, testBlocking.proceed = make(chan struct{}, 8), make(chan struct{})
+	store := NewMemStore()
+	opts := Options{Loops: 16, Bits: 10, Passes: 6, Store: store, Generator: blockingVersion}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewContext(ctx, opts); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// The first instance loads the table under a context that is cancelled while
+	// the second waits on it, so the second must load the table itself
+	first, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := NewContext(first, opts)
+		firstErr <- err
+	}()
+	<-testBlocking.started
+	second := make(chan error, 1)
+	go func() {
+		lx, err := New(opts)
+		if err == nil {
+			lx.Close()
+		}
+		second <- err
+	}()
+	for { // Wait until the second instance is waiting on the table
+		tablesMutex.Lock()
+		refs := tables[tableKey{bits: 10, passes: 6, generator: blockingVersion, store: storeID(store)}].refs
+		tablesMutex.Unlock()
+		if refs == 2 {
+			break
+		}
+		runtime.Gosched()
+	}
+	cancelFirst()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	<-testBlocking.started
+	close(testBlocking.proceed)
+	if err := <-second; err != nil {
+		t.Errorf("the waiting instance failed with its loader's context: %v", err)
+	}
+	if n := sharedTables(); n != 0 {
+		t.Errorf("%d tables shared after every LxrPow is closed", n)
+	}
+	if !store.Exists((&LxrPow{MapSize: 1 << 10, Passes: 6, Generator: blockingVersion}).TableName()) {
+		t.Error("the table was not saved")
+	}
+}
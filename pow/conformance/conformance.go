@@ -0,0 +1,330 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+// Package conformance checks implementations of LxrPoW against published test vectors.
+//
+// The vectors are kept in testdata/vectors.json.  Each table of vectors gives the
+// parameters (Loops, Bits, Passes and the ByteMap generator), the SHA-256 of the
+// ByteMap those parameters produce, and a list of (hash, nonce) inputs with the
+// output of Mix and of LxrPoW for each.  All binary values are hex encoded, and all
+// 64 bit values are hex strings so no precision is lost in other JSON parsers.
+//
+// Each vector also gives the 256 bit PoW.  The file also gives vectors for Absorb,
+// which folds input of any length into the 32 byte hash LxrPoW works on.
+//
+// Implementations in other languages can use the JSON file directly.  Go
+// implementations can use Check or Run.
+package conformance
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/pegnet/LXRPow/pow"
+)
+
+// FileVersion is the version of the vector file format
+const FileVersion = 1
+
+// Params
+// The parameters that define a PoW space
+type Params struct {
+	Loops     int                  `json:"loops"`
+	Bits      int                  `json:"bits"`
+	Passes    int                  `json:"passes"`
+	Generator pow.GeneratorVersion `json:"generator"`
+}
+
+func (p Params) String() string {
+	return fmt.Sprintf("loops=%d bits=%d passes=%d generator=%d", p.Loops, p.Bits, p.Passes, p.Generator)
+}
+
+// Vector
+// One input and its expected outputs
+type Vector struct {
+	Hash     string `json:"hash"`     // 32 byte input hash
+	Nonce    string `json:"nonce"`    // 64 bit nonce
+	Mix      string `json:"mix"`      // 40 byte hash returned by Mix(hash, nonce)
+	MixState string `json:"mixState"` // State returned by Mix(hash, nonce)
+	PoW      string `json:"pow"`      // LxrPoW(hash, nonce)
+	PoW256   string `json:"pow256"`   // LxrPoW256(hash, nonce)
+}
+
+// AbsorbVector
+// An input to Absorb and the hash it absorbs to
+type AbsorbVector struct {
+	Input string `json:"input"` // Input of any length
+	Hash  string `json:"hash"`  // 32 byte hash returned by Absorb(input)
+}
+
+// Table
+// The vectors for one set of parameters
+type Table struct {
+	Params        Params   `json:"params"`
+	ByteMapSHA256 string   `json:"byteMapSHA256"`
+	Vectors       []Vector `json:"vectors"`
+}
+
+// File
+// The contents of a test vector file
+type File struct {
+	Version     int            `json:"version"`
+	Description string         `json:"description"`
+	Tables      []Table        `json:"tables"`
+	Absorb      []AbsorbVector `json:"absorb,omitempty"`
+}
+
+// Instance
+// An implementation of LxrPoW built for one set of Params
+type Instance struct {
+	PoW     func(hash []byte, nonce uint64) (uint64, error)           // Required
+	Mix     func(hash []byte, nonce uint64) ([40]byte, uint64, error) // Checked if not nil
+	ByteMap []byte                                                    // Checked against the SHA-256 if not nil
+	Absorb  func(input []byte) [32]byte                               // Checked if not nil
+	PoW256  func(hash []byte, nonce uint64) (pow.Pow256, error)       // Checked if not nil
+}
+
+// Implementation builds an Instance for the given parameters
+type Implementation func(p Params) (Instance, error)
+
+// Reference is the implementation in the pow package.  ByteMaps are kept in
+// memory, so nothing is written to disk.
+func Reference() Implementation {
+	store := pow.NewMemStore()
+	return func(p Params) (Instance, error) {
+		lx, err := pow.New(pow.Options{Loops: p.Loops, Bits: p.Bits, Passes: p.Passes, Generator: p.Generator, Store: store})
+		if err != nil {
+			return Instance{}, err
+		}
+		return Instance{PoW: lx.PoW, Mix: pow.Mix, ByteMap: lx.ByteMap, Absorb: pow.Absorb, PoW256: lx.PoW256}, nil
+	}
+}
+
+// DefaultParams are the parameter sets the published vectors cover.  Bits are
+// kept small so the vectors can be checked quickly.
+var DefaultParams = []Params{
+	{Loops: 0, Bits: 8, Passes: 6, Generator: pow.GeneratorLegacy},
+	{Loops: 1, Bits: 8, Passes: 6, Generator: pow.GeneratorLegacy},
+	{Loops: 16, Bits: 8, Passes: 6, Generator: pow.GeneratorLegacy},
+	{Loops: 16, Bits: 12, Passes: 0, Generator: pow.GeneratorLegacy},
+	{Loops: 16, Bits: 12, Passes: 6, Generator: pow.GeneratorLegacy},
+	{Loops: 32, Bits: 16, Passes: 6, Generator: pow.GeneratorLegacy},
+	{Loops: 50, Bits: 16, Passes: 6, Generator: pow.GeneratorLegacy},
+	{Loops: 16, Bits: 20, Passes: 6, Generator: pow.GeneratorLegacy},
+	{Loops: 5, Bits: 10, Passes: 3, Generator: pow.GeneratorParallel},
+	{Loops: 16, Bits: 16, Passes: 6, Generator: pow.GeneratorParallel},
+}
+
+// AbsorbLengths are the input lengths the Absorb vectors cover: empty, short, either
+// side of 32 bytes, SHA-384 and SHA-512 digests, an 80 byte block header and a long
+// preimage.
+var AbsorbLengths = []int{0, 1, 31, 32, 33, 48, 64, 80, 200}
+
+// Generate
+// Builds a vector file with count vectors for each set of parameters, using the
+// given implementation to compute the expected outputs.
+func Generate(params []Params, count int, impl Implementation) (*File, error) {
+	f := &File{
+		Version: FileVersion,
+		Description: "LxrPoW test vectors. For each table, build the ByteMap from the params and check its " +
+			"SHA-256, then check Mix and LxrPoW for every (hash, nonce). 64 bit values are big endian hex.",
+	}
+	for ti, p := range params {
+		inst, err := impl(p)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", p, err)
+		}
+		table := Table{Params: p}
+		if inst.ByteMap != nil {
+			sum := sha256.Sum256(inst.ByteMap)
+			table.ByteMapSHA256 = hex.EncodeToString(sum[:])
+		}
+		for i := 0; i < count; i++ {
+			hash := sha256.Sum256([]byte(fmt.Sprintf("lxrpow conformance %d %d", ti, i)))
+			// Cover the edges of the nonce space, then nonces derived from the hash
+			var nonce uint64
+			switch i {
+			case 0:
+				nonce = 0
+			case 1:
+				nonce = 1
+			case 2:
+				nonce = ^uint64(0)
+			default:
+				nonce = binary.BigEndian.Uint64(hash[24:])
+			}
+			v := Vector{Hash: hex.EncodeToString(hash[:]), Nonce: hex64(nonce)}
+			if inst.Mix != nil {
+				mixed, state, err := inst.Mix(hash[:], nonce)
+				if err != nil {
+					return nil, err
+				}
+				v.Mix, v.MixState = hex.EncodeToString(mixed[:]), hex64(state)
+			}
+			pow, err := inst.PoW(hash[:], nonce)
+			if err != nil {
+				return nil, err
+			}
+			v.PoW = hex64(pow)
+			if inst.PoW256 != nil {
+				pow256, err := inst.PoW256(hash[:], nonce)
+				if err != nil {
+					return nil, err
+				}
+				v.PoW256 = pow256.String()
+			}
+			table.Vectors = append(table.Vectors, v)
+		}
+		f.Tables = append(f.Tables, table)
+		if inst.Absorb != nil && f.Absorb == nil {
+			f.Absorb = absorbVectors(inst.Absorb)
+		}
+	}
+	return f, nil
+}
+
+// absorbVectors builds a vector for each of the AbsorbLengths
+func absorbVectors(absorb func([]byte) [32]byte) (vectors []AbsorbVector) {
+	for _, length := range AbsorbLengths {
+		input := make([]byte, length)
+		for i := range input {
+			input[i] = byte(i*7 + length)
+		}
+		hash := absorb(input)
+		vectors = append(vectors, AbsorbVector{Input: hex.EncodeToString(input), Hash: hex.EncodeToString(hash[:])})
+	}
+	return vectors
+}
+
+// Load reads a vector file
+func Load(r io.Reader) (*File, error) {
+	f := new(File)
+	if err := json.NewDecoder(r).Decode(f); err != nil {
+		return nil, err
+	}
+	if f.Version != FileVersion {
+		return nil, fmt.Errorf("unsupported vector file version %d", f.Version)
+	}
+	return f, nil
+}
+
+// LoadFile reads the vector file at the given path
+func LoadFile(path string) (*File, error) {
+	fi, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+	return Load(fi)
+}
+
+// Write writes the vector file as indented JSON
+func (f *File) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(f)
+}
+
+// Check
+// Checks the implementation against every vector in the file, returning an
+// error for every mismatch.  No errors means the implementation conforms.
+func Check(f *File, impl Implementation) (errs []error) {
+	absorbChecked := false
+	for _, table := range f.Tables {
+		p := table.Params
+		inst, err := impl(p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", p, err))
+			continue
+		}
+		if inst.Absorb != nil && !absorbChecked {
+			errs = append(errs, checkAbsorb(f.Absorb, inst.Absorb)...)
+			absorbChecked = true
+		}
+		if inst.ByteMap != nil && table.ByteMapSHA256 != "" {
+			sum := sha256.Sum256(inst.ByteMap)
+			if got := hex.EncodeToString(sum[:]); got != table.ByteMapSHA256 {
+				errs = append(errs, fmt.Errorf("%v: ByteMap SHA-256 is %s, expected %s", p, got, table.ByteMapSHA256))
+			}
+		}
+		for i, v := range table.Vectors {
+			hash, err := hex.DecodeString(v.Hash)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%v vector %d: bad hash: %w", p, i, err))
+				continue
+			}
+			nonce, err := strconv.ParseUint(v.Nonce, 16, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%v vector %d: bad nonce: %w", p, i, err))
+				continue
+			}
+			if inst.Mix != nil && v.Mix != "" {
+				mixed, state, err := inst.Mix(hash, nonce)
+				switch {
+				case err != nil:
+					errs = append(errs, fmt.Errorf("%v vector %d: Mix: %w", p, i, err))
+				case hex.EncodeToString(mixed[:]) != v.Mix || hex64(state) != v.MixState:
+					errs = append(errs, fmt.Errorf("%v vector %d: Mix is %x %s, expected %s %s",
+						p, i, mixed, hex64(state), v.Mix, v.MixState))
+				}
+			}
+			pow, err := inst.PoW(hash, nonce)
+			switch {
+			case err != nil:
+				errs = append(errs, fmt.Errorf("%v vector %d: PoW: %w", p, i, err))
+			case hex64(pow) != v.PoW:
+				errs = append(errs, fmt.Errorf("%v vector %d: PoW is %s, expected %s", p, i, hex64(pow), v.PoW))
+			}
+			if inst.PoW256 != nil && v.PoW256 != "" {
+				pow256, err := inst.PoW256(hash, nonce)
+				switch {
+				case err != nil:
+					errs = append(errs, fmt.Errorf("%v vector %d: PoW256: %w", p, i, err))
+				case pow256.String() != v.PoW256:
+					errs = append(errs, fmt.Errorf("%v vector %d: PoW256 is %v, expected %s", p, i, pow256, v.PoW256))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// checkAbsorb checks Absorb against every absorb vector
+func checkAbsorb(vectors []AbsorbVector, absorb func([]byte) [32]byte) (errs []error) {
+	for i, v := range vectors {
+		input, err := hex.DecodeString(v.Input)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("absorb vector %d: bad input: %w", i, err))
+			continue
+		}
+		if hash := absorb(input); hex.EncodeToString(hash[:]) != v.Hash {
+			errs = append(errs, fmt.Errorf("absorb vector %d: hash of %d bytes is %x, expected %s", i, len(input), hash, v.Hash))
+		}
+	}
+	return errs
+}
+
+// Run checks the implementation against the vector file at path, reporting every
+// mismatch as a test error
+func Run(t testing.TB, path string, impl Implementation) {
+	t.Helper()
+	f, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range Check(f, impl) {
+		t.Error(err)
+	}
+}
+
+// hex64 formats a 64 bit value as 16 hex digits
+func hex64(v uint64) string {
+	return fmt.Sprintf("%016x", v)
+}
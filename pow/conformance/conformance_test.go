@@ -0,0 +1,56 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package conformance
+
+import (
+	"flag"
+	"os"
+	"testing"
+)
+
+const vectorFile = "testdata/vectors.json"
+
+var update = flag.Bool("update", false, "regenerate "+vectorFile+" from the reference implementation")
+
+func TestVectors(t *testing.T) {
+	if *update {
+		f, err := Generate(DefaultParams, 8, Reference())
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := os.Create(vectorFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer out.Close()
+		if err := f.Write(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Run(t, vectorFile, Reference())
+}
+
+func TestCheck_Mismatch(t *testing.T) {
+	f, err := LoadFile(vectorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An implementation that is off by one must fail every vector
+	ref := Reference()
+	broken := func(p Params) (Instance, error) {
+		inst, err := ref(p)
+		pow := inst.PoW
+		inst.PoW = func(hash []byte, nonce uint64) (uint64, error) {
+			v, err := pow(hash, nonce)
+			return v + 1, err
+		}
+		return inst, err
+	}
+	var vectors int
+	for _, table := range f.Tables {
+		vectors += len(table.Vectors)
+	}
+	if errs := Check(f, broken); len(errs) != vectors {
+		t.Errorf("expected %d mismatches, got %d", vectors, len(errs))
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Difficulty
+// A 64 bit difficulty target.  A PoW meets the difficulty if it is greater than or
+// equal to it.  PoW values are uniform, so the chance a hash meets a difficulty D
+// is (2^64 - D) / 2^64.  The arithmetic here works on that gap, 2^64 - D, with
+// integers, so no precision is lost near the top of the range where difficulties
+// are all leading FF bytes.
+type Difficulty uint64
+
+// two64 is 2^64, the size of the PoW space
+var two64 = new(big.Int).Lsh(big.NewInt(1), 64)
+
+// DifficultyFromBits returns the difficulty of a PoW with the given number of
+// leading one bits; 12 bits is 0xFFF0000000000000.  Bits over 64 are 64.
+func DifficultyFromBits(leadingBits int) Difficulty {
+	switch {
+	case leadingBits <= 0:
+		return 0
+	case leadingBits >= 64:
+		return Difficulty(^uint64(0))
+	}
+	return Difficulty(^uint64(0) << (64 - leadingBits))
+}
+
+// DifficultyFromHashes
+// Returns the difficulty a PoW meets once in the given number of hashes, on
+// average.  Zero or one hash is a difficulty of zero, which every PoW meets.
+func DifficultyFromHashes(hashes uint64) Difficulty {
+	if hashes <= 1 {
+		return 0
+	}
+	gap, _ := bits.Div64(1, 0, hashes) // 2^64 / hashes; hashes > 1, so it can't overflow
+	return Difficulty(-gap)
+}
+
+// LeadingBits returns the number of leading one bits of the difficulty
+func (d Difficulty) LeadingBits() int {
+	return bits.LeadingZeros64(^uint64(d))
+}
+
+// Meets reports if the PoW meets the difficulty
+func (d Difficulty) Meets(pow uint64) bool {
+	return pow >= uint64(d)
+}
+
+// gap returns 2^64 - d, the count of PoW values that meet the difficulty
+func (d Difficulty) gap() *big.Int {
+	return new(big.Int).Sub(two64, new(big.Int).SetUint64(uint64(d)))
+}
+
+// Work
+// Returns the expected number of hashes to meet the difficulty, 2^64 / (2^64 - d),
+// rounded down.  It is at least 1.
+func (d Difficulty) Work() *big.Int {
+	return new(big.Int).Quo(two64, d.gap())
+}
+
+// Hashes is Work as a float64, for display and rates
+func (d Difficulty) Hashes() float64 {
+	f, _ := new(big.Float).Quo(new(big.Float).SetInt(two64), new(big.Float).SetInt(d.gap())).Float64()
+	return f
+}
+
+// SumWork returns the total work of a list of difficulties, such as the
+// difficulties of a run of blocks
+func SumWork(difficulties ...Difficulty) *big.Int {
+	sum := new(big.Int)
+	for _, d := range difficulties {
+		sum.Add(sum, d.Work())
+	}
+	return sum
+}
+
+// Scale
+// Returns the difficulty that takes num/den times the work of d.  The result is
+// exact, rounded towards the higher difficulty, and saturates at 0 and at the
+// maximum difficulty.  A den of 0 is the maximum difficulty.
+func (d Difficulty) Scale(num, den uint64) Difficulty {
+	if den == 0 {
+		return Difficulty(^uint64(0))
+	}
+	if num == 0 {
+		return 0
+	}
+	// The work is 2^64 / gap, so scaling the work by num/den scales the gap by den/num
+	gap := d.gap()
+	gap.Mul(gap, new(big.Int).SetUint64(den))
+	gap.Quo(gap, new(big.Int).SetUint64(num))
+	switch {
+	case gap.Sign() == 0:
+		return Difficulty(^uint64(0))
+	case gap.Cmp(two64) >= 0:
+		return 0
+	}
+	return Difficulty(-gap.Uint64())
+}
+
+func (d Difficulty) String() string {
+	return fmt.Sprintf("0x%016x", uint64(d))
+}
+
+// ParseDifficulty
+// Parses a difficulty given as a number (decimal, or hex with a 0x prefix), or as
+// a count of leading one bits, like "12bits".
+func ParseDifficulty(s string) (Difficulty, error) {
+	s = strings.TrimSpace(s)
+	if n, ok := strings.CutSuffix(s, "bits"); ok {
+		leadingBits, err := strconv.Atoi(strings.TrimSpace(n))
+		if err != nil || leadingBits < 0 || leadingBits > 64 {
+			return 0, fmt.Errorf("difficulty %q: bits must be 0 to 64", s)
+		}
+		return DifficultyFromBits(leadingBits), nil
+	}
+	v, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("difficulty %q: %w", s, err)
+	}
+	return Difficulty(v), nil
+}
+
+// Set parses the difficulty with ParseDifficulty, so a Difficulty is a flag.Value
+func (d *Difficulty) Set(s string) error {
+	v, err := ParseDifficulty(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"flag"
+	"math/big"
+	"testing"
+)
+
+func TestDifficultyFromBits(t *testing.T) {
+	tests := []struct {
+		bits int
+		want Difficulty
+	}{
+		{-1, 0},
+		{0, 0},
+		{1, 0x8000000000000000},
+		{12, 0xFFF0000000000000},
+		{16, 0xFFFF000000000000},
+		{63, 0xFFFFFFFFFFFFFFFE},
+		{64, 0xFFFFFFFFFFFFFFFF},
+		{65, 0xFFFFFFFFFFFFFFFF},
+	}
+	for _, tt := range tests {
+		d := DifficultyFromBits(tt.bits)
+		if d != tt.want {
+			t.Errorf("DifficultyFromBits(%d) = %v, expected %v", tt.bits, d, tt.want)
+		}
+		if tt.bits >= 0 && tt.bits <= 64 && d.LeadingBits() != tt.bits {
+			t.Errorf("%v has %d leading bits, expected %d", d, d.LeadingBits(), tt.bits)
+		}
+	}
+}
+
+func TestDifficulty_Work(t *testing.T) {
+	// Every n leading bits takes 2^n hashes
+	for bits := 0; bits <= 64; bits++ {
+		want := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+		if bits == 64 {
+			want.Sub(two64, big.NewInt(0)) // The maximum difficulty is met by one PoW value
+		}
+		if work := DifficultyFromBits(bits).Work(); work.Cmp(want) != 0 {
+			t.Errorf("%d bits: work %v, expected %v", bits, work, want)
+		}
+	}
+	for _, hashes := range []uint64{2, 3, 1000, 1 << 40, 1 << 62} {
+		d := DifficultyFromHashes(hashes)
+		if work := d.Work(); !work.IsUint64() || work.Uint64() != hashes {
+			t.Errorf("DifficultyFromHashes(%d) takes %v hashes", hashes, work)
+		}
+	}
+	// Past 2^63 hashes the only difficulty left is the maximum
+	for _, hashes := range []uint64{1<<63 + 1, ^uint64(0)} {
+		if d := DifficultyFromHashes(hashes); d != DifficultyFromBits(64) {
+			t.Errorf("DifficultyFromHashes(%d) = %v", hashes, d)
+		}
+	}
+	if DifficultyFromHashes(0) != 0 || DifficultyFromHashes(1) != 0 {
+		t.Error("one hash or less is no difficulty")
+	}
+	if h := DifficultyFromBits(20).Hashes(); h != 1<<20 {
+		t.Errorf("20 bits is %v hashes", h)
+	}
+
+	sum := SumWork(DifficultyFromBits(4), DifficultyFromBits(8), DifficultyFromBits(64))
+	want := new(big.Int).Add(big.NewInt(16+256), two64)
+	if sum.Cmp(want) != 0 {
+		t.Errorf("sum of work is %v, expected %v", sum, want)
+	}
+}
+
+func TestDifficulty_Scale(t *testing.T) {
+	d := DifficultyFromBits(16)
+	if got := d.Scale(2, 1); got != DifficultyFromBits(17) {
+		t.Errorf("twice the work of 16 bits is %v", got)
+	}
+	if got := d.Scale(1, 2); got != DifficultyFromBits(15) {
+		t.Errorf("half the work of 16 bits is %v", got)
+	}
+	if got := d.Scale(7, 7); got != d {
+		t.Errorf("scaling by 1 changed %v to %v", d, got)
+	}
+
+	// Scaling must be exact where floats are not: one step above the max
+	// representable float64 near 2^64 is still adjusted
+	d = Difficulty(0xFFFFFFFFFFFFF000)
+	if got := d.Scale(0x1000, 0x800); got != 0xFFFFFFFFFFFFF800 {
+		t.Errorf("twice the work of %v is %v", d, got)
+	}
+
+	// Saturation
+	if got := DifficultyFromBits(60).Scale(1<<10, 1); got != DifficultyFromBits(64) {
+		t.Errorf("more work than the maximum is %v", got)
+	}
+	if got := DifficultyFromBits(4).Scale(1, 1<<10); got != 0 {
+		t.Errorf("less work than none is %v", got)
+	}
+	if d.Scale(0, 1) != 0 || d.Scale(1, 0) != Difficulty(^uint64(0)) {
+		t.Error("zero ratios do not saturate")
+	}
+}
+
+func TestParseDifficulty(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Difficulty
+		ok   bool
+	}{
+		{"0xFFF0000000000000", 0xFFF0000000000000, true},
+		{"12bits", 0xFFF0000000000000, true},
+		{" 16 bits ", 0xFFFF000000000000, true},
+		{"1000", 1000, true},
+		{"65bits", 0, false},
+		{"bits", 0, false},
+		{"0x1FFFFFFFFFFFFFFFF", 0, false},
+		{"difficult", 0, false},
+	}
+	for _, tt := range tests {
+		d, err := ParseDifficulty(tt.in)
+		if (err == nil) != tt.ok || d != tt.want {
+			t.Errorf("ParseDifficulty(%q) = %v, %v", tt.in, d, err)
+		}
+	}
+
+	// A Difficulty is a flag.Value
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var d Difficulty
+	fs.Var(&d, "difficulty", "")
+	if err := fs.Parse([]string{"--difficulty", "20bits"}); err != nil {
+		t.Fatal(err)
+	}
+	if d != DifficultyFromBits(20) || d.String() != "0xfffff00000000000" {
+		t.Errorf("flag parsed to %v", d)
+	}
+	if !d.Meets(uint64(d)) || d.Meets(uint64(d)-1) {
+		t.Error("Meets is wrong")
+	}
+}
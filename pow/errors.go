@@ -0,0 +1,18 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"errors"
+)
+
+// Errors returned by the pow package.  Callers should test for them with errors.Is,
+// since most are wrapped with the details of the failure.
+var (
+	ErrBitsOutOfRange      = errors.New("bits out of range: ByteMaps greater than 4 GB are not allowed")
+	ErrTableCorrupt        = errors.New("ByteMap table is corrupt")
+	ErrCacheDirUnavailable = errors.New("ByteMap cache directory is unavailable")
+	ErrHashLength          = errors.New("must provide a 32 byte hash")
+	ErrUnknownGenerator    = errors.New("unknown ByteMap generator version")
+	ErrUnknownAlgorithm    = errors.New("unknown PoW algorithm")
+)
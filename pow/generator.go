@@ -0,0 +1,148 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// GeneratorVersion identifies the algorithm used to generate a ByteMap.
+// Different generators produce different ByteMaps from the same Bits and Passes.
+type GeneratorVersion uint16
+
+// GeneratorLegacy is the original, single threaded shuffle
+const GeneratorLegacy GeneratorVersion = 1
+
+// GeneratorParallel shuffles segments of the ByteMap on all cores.  The ByteMap
+// it builds depends only on Bits and Passes, never on the number of cores.
+const GeneratorParallel GeneratorVersion = 2
+
+// Progress
+// Reported by generators as they build a ByteMap
+type Progress struct {
+	Generator GeneratorVersion // The generator building the ByteMap
+	Pass      int              // The pass being performed, counting from 0
+	Passes    int              // Total number of passes
+	Done      uint64           // Work done so far in this pass
+	Total     uint64           // Total work in this pass
+}
+
+// Percent returns how far through all the passes the generator is
+func (p Progress) Percent() float64 {
+	if p.Passes == 0 || p.Total == 0 {
+		return 100
+	}
+	return 100 * (float64(p.Pass) + float64(p.Done)/float64(p.Total)) / float64(p.Passes)
+}
+
+// ProgressFunc is called by generators to report progress.  It may be called
+// from several goroutines, but never concurrently.
+type ProgressFunc func(Progress)
+
+// Generator
+// Builds a ByteMap.  Every generator must fill the ByteMap with an equal count of
+// each byte value, and must always build the same ByteMap given the same size and
+// passes.
+type Generator interface {
+	Version() GeneratorVersion
+	Generate(byteMap []byte, passes int, progress ProgressFunc)
+}
+
+// ContextGenerator
+// Implemented by Generators that can stop part way through a ByteMap when the
+// context is done.  The ByteMap is left partly shuffled, and the context's error
+// is returned.
+type ContextGenerator interface {
+	GenerateContext(ctx context.Context, byteMap []byte, passes int, progress ProgressFunc) error
+}
+
+var generatorsMutex sync.RWMutex
+var generators = map[GeneratorVersion]Generator{}
+
+func init() {
+	RegisterGenerator(legacyGenerator{})
+	RegisterGenerator(parallelGenerator{})
+}
+
+// RegisterGenerator
+// Makes a generator available by its version.  Panics if the version is already registered.
+func RegisterGenerator(g Generator) {
+	generatorsMutex.Lock()
+	defer generatorsMutex.Unlock()
+	if _, exists := generators[g.Version()]; exists {
+		panic(fmt.Sprintf("generator version %d is already registered", g.Version()))
+	}
+	generators[g.Version()] = g
+}
+
+// LookupGenerator returns the generator registered with the given version
+func LookupGenerator(version GeneratorVersion) (Generator, error) {
+	generatorsMutex.RLock()
+	defer generatorsMutex.RUnlock()
+	g, ok := generators[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownGenerator, version)
+	}
+	return g, nil
+}
+
+// progressEvery is how many bytes are shuffled between progress reports
+const progressEvery = 1 << 22
+
+// legacyGenerator is the original single threaded shuffle.  Every swap depends on
+// the swaps before it, so it cannot be split across cores.
+type legacyGenerator struct{}
+
+func (legacyGenerator) Version() GeneratorVersion { return GeneratorLegacy }
+
+// Generate
+// Initializes the map with an incremental sequence of bytes,
+// then does P passes, shuffling each element in a deterministic manner.
+func (g legacyGenerator) Generate(byteMap []byte, passes int, progress ProgressFunc) {
+	g.GenerateContext(context.Background(), byteMap, passes, progress)
+}
+
+// GenerateContext is Generate, checking the context every progressEvery bytes
+func (legacyGenerator) GenerateContext(ctx context.Context, byteMap []byte, passes int, progress ProgressFunc) error {
+	var offset uint64 = 204598345089
+	// Our own "random" generator that really is just used to shuffle values
+	MapMask := uint64(len(byteMap)) - 1
+	// The random index used to shuffle the ByteMap is itself computed through the ByteMap table
+	// in a deterministic pattern.
+	rand := func(i, r uint64) uint64 {
+		offset = offset<<9 ^ offset>>7 ^ i ^ r
+		return uint64(offset) & MapMask
+	}
+
+	// Fill the ByteMap with bytes ranging from 0 to 255.  As long as MapSize%256 == 0, this
+	// looping and masking works just fine.
+	for i := range byteMap {
+		byteMap[i] = byte(i)
+	}
+
+	// Now what we want to do is just mix it all up.  Take every byte in the ByteMap list, and exchange it
+	// for some other byte in the ByteMap list. Note that we do this over and over, mixing and more mixing
+	// the ByteMap, but maintaining the ratio of each byte value in the ByteMap list.
+	total := uint64(len(byteMap))
+	var r uint64
+	for pass := 0; pass < passes; pass++ {
+		for i := range byteMap {
+			if (i+1)%progressEvery == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if progress != nil {
+					progress(Progress{GeneratorLegacy, pass, passes, uint64(i + 1), total})
+				}
+			}
+			r = rand(uint64(i), r)
+			byteMap[i], byteMap[r] = byteMap[r], byteMap[i]
+		}
+		if progress != nil {
+			progress(Progress{GeneratorLegacy, pass, passes, total, total})
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,194 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"context"
+	"encoding/binary"
+	"math/bits"
+	"runtime"
+	"sync"
+)
+
+// parallelGenerator
+// Splits the ByteMap into segments that are shuffled independently, so the work
+// can be spread over every core.  Each pass:
+//
+//  1. Shuffles every segment with a Fisher-Yates shuffle.
+//  2. Mixes the segments together through a butterfly network.  In round r, each
+//     segment s is paired with segment s^(1<<r), and each byte is randomly
+//     exchanged with the byte at the same offset in the paired segment.
+//
+// After the log2(segments) rounds of a pass, any byte can have moved to any
+// segment.  Every random number is derived from (pass, segment, round) alone, and
+// the segments are fixed by the size of the ByteMap, so the ByteMap built does not
+// depend on the number of cores used.
+type parallelGenerator struct {
+	workers int // Goroutines to use; 0 uses GOMAXPROCS
+}
+
+func (parallelGenerator) Version() GeneratorVersion { return GeneratorParallel }
+
+// segmentLength returns the length of the segments a ByteMap of the given size
+// is split into.  There are at most 256 segments, and each is at least 256 bytes.
+func segmentLength(size int) int {
+	if size>>8 < 256 {
+		if size < 256 {
+			return size
+		}
+		return 256
+	}
+	return size >> 8
+}
+
+func (g parallelGenerator) Generate(byteMap []byte, passes int, progress ProgressFunc) {
+	g.GenerateContext(context.Background(), byteMap, passes, progress)
+}
+
+// GenerateContext is Generate, checking the context before each segment is
+// shuffled or mixed
+func (g parallelGenerator) GenerateContext(ctx context.Context, byteMap []byte, passes int, progress ProgressFunc) error {
+	workers := g.workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	segLen := segmentLength(len(byteMap))
+	segments := len(byteMap) / segLen
+	rounds := bits.TrailingZeros(uint(segments))
+	total := uint64(len(byteMap)) * uint64(1+rounds)
+
+	var mu sync.Mutex
+	var done uint64
+	report := func(pass int, n int) {
+		if progress == nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		done += uint64(n)
+		progress(Progress{GeneratorParallel, pass, passes, done, total})
+	}
+
+	// run calls fn for every job from 0 to n-1, spread over the workers.  Jobs
+	// not started when the context is done are skipped.
+	run := func(n int, fn func(job int)) error {
+		var wg sync.WaitGroup
+		jobs := make(chan int, n)
+		for i := 0; i < n; i++ {
+			jobs <- i
+		}
+		close(jobs)
+		for w := 0; w < workers && w < n; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for job := range jobs {
+					if ctx.Err() != nil {
+						return
+					}
+					fn(job)
+				}
+			}()
+		}
+		wg.Wait()
+		return ctx.Err()
+	}
+
+	// Fill the ByteMap with bytes ranging from 0 to 255
+	err := run(segments, func(s int) {
+		seg := byteMap[s*segLen : (s+1)*segLen]
+		for i := range seg {
+			seg[i] = byte(i)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for pass := 0; pass < passes; pass++ {
+		done = 0
+		err := run(segments, func(s int) {
+			seg := byteMap[s*segLen : (s+1)*segLen]
+			r := newGenRand(uint64(pass), uint64(s), 0)
+			for i := len(seg) - 1; i > 0; i-- {
+				j := r.below(uint64(i + 1))
+				seg[i], seg[j] = seg[j], seg[i]
+			}
+			report(pass, segLen)
+		})
+		if err != nil {
+			return err
+		}
+
+		for round := 0; round < rounds; round++ {
+			m := 1 << round
+			err := run(segments/2, func(pair int) {
+				// The pair'th segment without bit m set, and its partner with it set
+				s := (pair>>round)<<(round+1) | pair&(m-1)
+				a := byteMap[s*segLen : (s+1)*segLen]
+				b := byteMap[(s|m)*segLen : ((s|m)+1)*segLen]
+				r := newGenRand(uint64(pass), uint64(s), uint64(round+1))
+				// Byte i is exchanged if bit i%64 of the current random word is set.
+				// Eight bytes are exchanged at a time, without branches.
+				var swaps uint64
+				for i := 0; i < len(a); i += 8 {
+					if i%64 == 0 {
+						swaps = r.next()
+					}
+					mask := byteMasks[byte(swaps>>(i%64))]
+					x := (binary.LittleEndian.Uint64(a[i:]) ^ binary.LittleEndian.Uint64(b[i:])) & mask
+					binary.LittleEndian.PutUint64(a[i:], binary.LittleEndian.Uint64(a[i:])^x)
+					binary.LittleEndian.PutUint64(b[i:], binary.LittleEndian.Uint64(b[i:])^x)
+				}
+				report(pass, 2*segLen)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// byteMasks maps each bit of a byte to a byte of 0xFF in a little endian word
+var byteMasks = func() (masks [256]uint64) {
+	for v := range masks {
+		for bit := 0; bit < 8; bit++ {
+			if v>>bit&1 == 1 {
+				masks[v] |= 0xFF << (8 * bit)
+			}
+		}
+	}
+	return masks
+}()
+
+// genRand is a xorshift64* generator used by the parallel generator
+type genRand struct {
+	x uint64
+}
+
+// newGenRand seeds a generator for the given pass, segment and round using splitmix64
+func newGenRand(pass, segment, round uint64) genRand {
+	z := 204598345089 ^ pass<<48 ^ segment<<16 ^ round
+	z += 0x9e3779b97f4a7c15
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	z ^= z >> 31
+	if z == 0 {
+		z = 0x9e3779b97f4a7c15 // xorshift must never be seeded with zero
+	}
+	return genRand{z}
+}
+
+func (r *genRand) next() uint64 {
+	r.x ^= r.x >> 12
+	r.x ^= r.x << 25
+	r.x ^= r.x >> 27
+	return r.x * 2685821657736338717
+}
+
+// below returns a random number in [0, n)
+func (r *genRand) below(n uint64) uint64 {
+	hi, _ := bits.Mul64(r.next(), n)
+	return hi
+}
@@ -0,0 +1,119 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// checkBalanced fails the test unless every byte value appears equally often
+func checkBalanced(t *testing.T, byteMap []byte) {
+	t.Helper()
+	var sums [256]int
+	for _, b := range byteMap {
+		sums[b]++
+	}
+	for v, cnt := range sums {
+		if cnt != len(byteMap)/256 {
+			t.Fatalf("byte %02x appears %d times, expected %d", v, cnt, len(byteMap)/256)
+		}
+	}
+}
+
+func TestLegacyGenerator(t *testing.T) {
+	// The legacy generator must never change, or every cached table and PoW changes with it
+	sums := map[int]string{
+		8:  "8667e798a4593805530b9ce065a941ce76244cded5019b9f4793791999fd4027",
+		12: "d358952b5455ddc5dbaf032a173e6bc199789a76e6fc1ffb5b8ba36d1398f18c",
+		16: "a2cf0ea399d897852fd021e939d61f9988a3bb57964b960ac214771ec877d419",
+	}
+	for bits, want := range sums {
+		byteMap := make([]byte, 1<<bits)
+		legacyGenerator{}.Generate(byteMap, 6, nil)
+		sum := sha256.Sum256(byteMap)
+		if hex.EncodeToString(sum[:]) != want {
+			t.Errorf("legacy ByteMap for %d bits changed", bits)
+		}
+		checkBalanced(t, byteMap)
+	}
+}
+
+func TestParallelGenerator(t *testing.T) {
+	for _, bits := range []int{8, 12, 17, 20} {
+		one := make([]byte, 1<<bits)
+		parallelGenerator{workers: 1}.Generate(one, 4, nil)
+		checkBalanced(t, one)
+		for _, workers := range []int{2, 3, 8} {
+			many := make([]byte, 1<<bits)
+			parallelGenerator{workers: workers}.Generate(many, 4, nil)
+			if !bytes.Equal(one, many) {
+				t.Fatalf("%d bit ByteMap differs with %d workers", bits, workers)
+			}
+		}
+		legacy := make([]byte, 1<<bits)
+		legacyGenerator{}.Generate(legacy, 4, nil)
+		if bytes.Equal(one, legacy) {
+			t.Errorf("%d bit ByteMap is the same as the legacy ByteMap", bits)
+		}
+	}
+}
+
+func TestGeneratorProgress(t *testing.T) {
+	for _, version := range []GeneratorVersion{GeneratorLegacy, GeneratorParallel} {
+		var last Progress
+		var percent float64
+		calls := 0
+		lx, err := New(Options{Loops: 16, Bits: 16, Passes: 3, Store: NewMemStore(), Generator: version,
+			Progress: func(p Progress) {
+				if p.Percent() < percent {
+					t.Errorf("generator %d progress went backwards: %v after %v", version, p, last)
+				}
+				last, percent = p, p.Percent()
+				calls++
+			}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if calls == 0 || last.Percent() != 100 || last.Generator != version {
+			t.Errorf("generator %d reported %d times, finishing at %v", version, calls, last)
+		}
+		checkBalanced(t, lx.ByteMap)
+		lx.Close()
+	}
+
+	if _, err := New(Options{Bits: 8, Generator: 99, Store: NewMemStore()}); err == nil {
+		t.Error("expected an error for an unknown generator")
+	}
+}
+
+func TestGeneratorContext(t *testing.T) {
+	for _, g := range []ContextGenerator{legacyGenerator{}, parallelGenerator{}} {
+		ctx, cancel := context.WithCancel(context.Background())
+		var last Progress
+		err := g.GenerateContext(ctx, make([]byte, 1<<23), 6, func(p Progress) {
+			last = p
+			cancel()
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("generator %d: expected context.Canceled, got %v", g.(Generator).Version(), err)
+		}
+		if last.Pass != 0 {
+			t.Errorf("generator %d kept going to pass %d after it was cancelled", g.(Generator).Version(), last.Pass)
+		}
+	}
+
+	lx := &LxrPow{MapSize: 256, Passes: 6}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := lx.GenerateTableContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if lx.ByteMap != nil {
+		t.Error("ByteMap kept after generating was cancelled")
+	}
+}
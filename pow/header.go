@@ -0,0 +1,114 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// HeaderSize is the number of bytes in front of the ByteMap in a cached table.
+// A full page keeps the ByteMap page aligned in the file.
+const HeaderSize = 4096
+
+// HeaderVersion is the version of the table header written by this code
+const HeaderVersion = 1
+
+// headerMagic identifies a cached ByteMap table
+var headerMagic = []byte("LXRPOWBM")
+
+// TableHeader
+// Leads every cached ByteMap table, and records what the table is so it can be
+// verified when loaded.
+//
+//	 0  8 bytes  magic "LXRPOWBM"
+//	 8  2 bytes  header version
+//	10  2 bytes  Bits
+//	12  4 bytes  Passes
+//	16  2 bytes  generator version
+//	18  6 bytes  reserved
+//	24  8 bytes  size of the ByteMap in bytes
+//	32 32 bytes  SHA-256 of the ByteMap
+//
+// All values are big endian. The rest of the HeaderSize bytes are zero.
+type TableHeader struct {
+	Version   uint16           // Version of the header format
+	Bits      uint16           // Number of bits addressing the ByteMap
+	Passes    uint32           // Number of shuffles used to generate the ByteMap
+	Generator GeneratorVersion // Generator used to build the ByteMap
+	Size      uint64           // Size of the ByteMap
+	Sum       [32]byte         // SHA-256 of the ByteMap
+}
+
+// NewTableHeader
+// Builds the header describing the given ByteMap
+func NewTableHeader(bits, passes int, generator GeneratorVersion, byteMap []byte) TableHeader {
+	return TableHeader{
+		Version:   HeaderVersion,
+		Bits:      uint16(bits),
+		Passes:    uint32(passes),
+		Generator: generator,
+		Size:      uint64(len(byteMap)),
+		Sum:       sha256.Sum256(byteMap),
+	}
+}
+
+// Put writes the header into the first HeaderSize bytes of buf
+func (h TableHeader) Put(buf []byte) {
+	buf = buf[:HeaderSize]
+	for i := range buf {
+		buf[i] = 0
+	}
+	copy(buf, headerMagic)
+	binary.BigEndian.PutUint16(buf[8:], h.Version)
+	binary.BigEndian.PutUint16(buf[10:], h.Bits)
+	binary.BigEndian.PutUint32(buf[12:], h.Passes)
+	binary.BigEndian.PutUint16(buf[16:], uint16(h.Generator))
+	binary.BigEndian.PutUint64(buf[24:], h.Size)
+	copy(buf[32:64], h.Sum[:])
+}
+
+// ParseTableHeader reads the header at the front of a cached table
+func ParseTableHeader(buf []byte) (h TableHeader, err error) {
+	if len(buf) < HeaderSize || !bytes.Equal(buf[:len(headerMagic)], headerMagic) {
+		return h, fmt.Errorf("%w: no table header", ErrTableCorrupt)
+	}
+	h.Version = binary.BigEndian.Uint16(buf[8:])
+	h.Bits = binary.BigEndian.Uint16(buf[10:])
+	h.Passes = binary.BigEndian.Uint32(buf[12:])
+	h.Generator = GeneratorVersion(binary.BigEndian.Uint16(buf[16:]))
+	h.Size = binary.BigEndian.Uint64(buf[24:])
+	copy(h.Sum[:], buf[32:64])
+	if h.Version != HeaderVersion {
+		return h, fmt.Errorf("%w: unsupported header version %d", ErrTableCorrupt, h.Version)
+	}
+	return h, nil
+}
+
+// VerifyTable
+// Checks a cached table (header followed by the ByteMap) against the header
+// expected, and returns the ByteMap.  If trusted is true, the SHA-256 of the
+// ByteMap is not recomputed; only the header and the length are checked.
+func VerifyTable(table []byte, want TableHeader, trusted bool) ([]byte, error) {
+	h, err := ParseTableHeader(table)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case h.Bits != want.Bits:
+		return nil, fmt.Errorf("%w: table has %d bits, expected %d", ErrTableCorrupt, h.Bits, want.Bits)
+	case h.Passes != want.Passes:
+		return nil, fmt.Errorf("%w: table has %d passes, expected %d", ErrTableCorrupt, h.Passes, want.Passes)
+	case h.Generator != want.Generator:
+		return nil, fmt.Errorf("%w: table has generator %d, expected %d", ErrTableCorrupt, h.Generator, want.Generator)
+	case h.Size != want.Size || uint64(len(table)-HeaderSize) != h.Size:
+		return nil, fmt.Errorf("%w: table is %d bytes, expected %d", ErrTableCorrupt, len(table)-HeaderSize, want.Size)
+	}
+	byteMap := table[HeaderSize:]
+	if !trusted && sha256.Sum256(byteMap) != h.Sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrTableCorrupt)
+	}
+	return byteMap, nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestTableHeader(t *testing.T) {
+	store := NewMemStore()
+	lx, err := New(Options{Loops: 16, Bits: 12, Passes: 6, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := append([]byte{}, lx.ByteMap...)
+	name := lx.TableName()
+	lx.Close() // So the tables below are loaded from the store
+	want := TableHeader{Version: HeaderVersion, Bits: 12, Passes: 6, Generator: GeneratorLegacy, Size: 1 << 12}
+
+	table, _ := store.Load(name)
+	if _, err := VerifyTable(table, want, false); err != nil {
+		t.Fatalf("saved table does not verify: %v", err)
+	}
+	wrongPasses := want
+	wrongPasses.Passes = 5
+	if _, err := VerifyTable(table, wrongPasses, false); !errors.Is(err, ErrTableCorrupt) {
+		t.Errorf("expected ErrTableCorrupt for the wrong passes, got %v", err)
+	}
+	if _, err := VerifyTable(table[HeaderSize:], want, false); !errors.Is(err, ErrTableCorrupt) {
+		t.Errorf("expected ErrTableCorrupt for a table without a header, got %v", err)
+	}
+
+	// Flip a bit in the ByteMap.  A trusted load accepts it, a normal load
+	// regenerates the table.
+	table[HeaderSize+100] ^= 1
+	if _, err := VerifyTable(table, want, false); !errors.Is(err, ErrTableCorrupt) {
+		t.Errorf("expected ErrTableCorrupt for a bit flip, got %v", err)
+	}
+	trusted, err := New(Options{Loops: 16, Bits: 12, Passes: 6, Store: store, TrustCache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(trusted.ByteMap, good) {
+		t.Error("trusted load should not have checked the SHA-256")
+	}
+	defer trusted.Close()
+	lx2, err := New(Options{Loops: 16, Bits: 12, Passes: 6, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx2.Close()
+	if !bytes.Equal(lx2.ByteMap, good) {
+		t.Error("corrupt table was not regenerated")
+	}
+	table, _ = store.Load(name)
+	if _, err := VerifyTable(table, want, false); err != nil {
+		t.Errorf("regenerated table was not saved: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"fmt"
+)
+
+// AccessRegions is the number of equal regions of the ByteMap that Instrumented
+// counts reads in
+const AccessRegions = 64
+
+// AccessStats
+// The ByteMap reads counted by an Instrumented LxrPow
+type AccessStats struct {
+	Hashes  uint64                `json:"hashes"`
+	Reads   uint64                `json:"reads"`
+	Outside uint64                `json:"outside"` // Reads outside a reduced table, which read the wrong byte
+	Regions [AccessRegions]uint64 `json:"regions"` // Reads in each region of the full ByteMap, by the address LxrPoW asked for
+}
+
+// Add adds the counts of o to s, to combine the stats of several instances
+func (s *AccessStats) Add(o AccessStats) {
+	s.Hashes += o.Hashes
+	s.Reads += o.Reads
+	s.Outside += o.Outside
+	for i, r := range o.Regions {
+		s.Regions[i] += r
+	}
+}
+
+// ReadsPerHash returns the average ByteMap reads made by a hash
+func (s AccessStats) ReadsPerHash() float64 {
+	if s.Hashes == 0 {
+		return 0
+	}
+	return float64(s.Reads) / float64(s.Hashes)
+}
+
+// OutsideRate returns the fraction of reads that fell outside a reduced table
+func (s AccessStats) OutsideRate() float64 {
+	if s.Reads == 0 {
+		return 0
+	}
+	return float64(s.Outside) / float64(s.Reads)
+}
+
+// RegionChiSquare
+// Returns the chi-square of the reads in each region against an equal spread over
+// the ByteMap, with AccessRegions-1 degrees of freedom.  Reads spread uniformly
+// give about AccessRegions-1; far more means some of the ByteMap is favoured, and
+// a miner could keep only that part.
+func (s AccessStats) RegionChiSquare() (chi float64) {
+	if s.Reads == 0 {
+		return 0
+	}
+	expected := float64(s.Reads) / AccessRegions
+	for _, r := range s.Regions {
+		d := float64(r) - expected
+		chi += d * d / expected
+	}
+	return chi
+}
+
+// Instrumented
+// An LxrPow that counts its ByteMap reads and where in the ByteMap they fall, to
+// measure how memory bound LxrPoW is.
+//
+// It can also simulate a reduced table.  With TableBits below the Bits of the
+// LxrPow, every read is folded into the first 2^TableBits bytes of the ByteMap, as
+// a miner keeping only part of the table would have to do.  Reads that fall
+// outside the reduced table get the wrong byte, so the PoW computed is usually not
+// the true PoW; comparing it to LxrPoW measures the cost of the shortcut.
+//
+// An Instrumented is not safe for concurrent use.  Give each goroutine its own, and
+// combine their stats with AccessStats.Add.
+type Instrumented struct {
+	lx          *LxrPow
+	tableBits   int
+	mask        uint64 // Mask of the full ByteMap
+	tableMask   uint64 // Mask of the reduced table
+	regionShift uint   // Shifts an address to its region
+	stats       AccessStats
+}
+
+// NewInstrumented
+// Returns an instrumented LxrPow reading a table of 2^tableBits bytes.  A tableBits
+// of 0 reads the whole ByteMap.  The ByteMap of lx is used, not copied, so lx must
+// not be closed while the Instrumented is in use.
+func NewInstrumented(lx *LxrPow, tableBits int) (*Instrumented, error) {
+	bits := lx.Bits()
+	if tableBits == 0 {
+		tableBits = bits
+	}
+	if tableBits < 8 || tableBits > bits {
+		return nil, fmt.Errorf("%w: a reduced table must have 8 to %d bits, got %d", ErrBitsOutOfRange, bits, tableBits)
+	}
+	return &Instrumented{
+		lx:          lx,
+		tableBits:   tableBits,
+		mask:        lx.MapSize - 1,
+		tableMask:   uint64(1)<<tableBits - 1,
+		regionShift: uint(bits - 6), // AccessRegions is 2^6, and Bits is at least 8
+	}, nil
+}
+
+// TableBits returns the bits of the table read, which are the Bits of the LxrPow
+// unless the table is reduced
+func (in *Instrumented) TableBits() int {
+	return in.tableBits
+}
+
+// Stats returns the reads counted since the Instrumented was made or Reset
+func (in *Instrumented) Stats() AccessStats {
+	return in.stats
+}
+
+// Reset clears the counts
+func (in *Instrumented) Reset() {
+	in.stats = AccessStats{}
+}
+
+// LxrPoW
+// Computes the proof of work as LxrPow.LxrPoW does, counting the reads.  With a
+// reduced table the result is only right if no read fell outside it.
+//
+// LxrPoW panics if the hash is not 32 bytes long; use PoW to get an error instead.
+func (in *Instrumented) LxrPoW(hash []byte, nonce uint64) (pow uint64) {
+	pow, err := in.PoW(hash, nonce)
+	if err != nil {
+		panic(err)
+	}
+	return pow
+}
+
+// PoW is LxrPoW, returning an error rather than panicking
+func (in *Instrumented) PoW(hash []byte, nonce uint64) (pow uint64, err error) {
+	LHash, state, err := Mix(hash, nonce)
+	if err != nil {
+		return 0, err
+	}
+	byteMap := in.lx.ByteMap
+	for i := 0; i < in.lx.Loops; i++ {
+		for j, v := range LHash {
+			index := state & in.mask
+			read := index & in.tableMask
+			in.stats.Regions[index>>in.regionShift]++
+			if read != index {
+				in.stats.Outside++
+			}
+			state = state<<17 ^ state>>7 ^ uint64(byteMap[read]^v)
+			LHash[j] = byte(state)
+		}
+	}
+	in.stats.Hashes++
+	in.stats.Reads += uint64(in.lx.Loops * len(LHash))
+	return mixState(hash, state), nil
+}
@@ -0,0 +1,93 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestInstrumented(t *testing.T) {
+	lx, err := New(Options{Loops: 8, Bits: 12, Passes: 6, Store: NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+
+	full, err := NewInstrumented(lx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.TableBits() != 12 {
+		t.Errorf("expected the full table of 12 bits, got %d", full.TableBits())
+	}
+	reduced, err := NewInstrumented(lx, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrong := 0
+	for i := 0; i < 1000; i++ {
+		hash := sha256.Sum256([]byte{byte(i), byte(i >> 8)})
+		pow := lx.LxrPoW(hash[:], uint64(i))
+		if got := full.LxrPoW(hash[:], uint64(i)); got != pow {
+			t.Fatalf("instrumented PoW %x differs from LxrPoW %x", got, pow)
+		}
+		if reduced.LxrPoW(hash[:], uint64(i)) != pow {
+			wrong++
+		}
+	}
+	if wrong < 990 {
+		t.Errorf("a table 1/16 the size got %d of 1000 PoWs right", 1000-wrong)
+	}
+
+	s := full.Stats()
+	if s.Hashes != 1000 || s.Reads != 1000*8*40 || s.ReadsPerHash() != 8*40 {
+		t.Errorf("wrong counts: hashes %d reads %d", s.Hashes, s.Reads)
+	}
+	if s.Outside != 0 {
+		t.Errorf("the full table had %d reads outside it", s.Outside)
+	}
+	var regions uint64
+	for _, r := range s.Regions {
+		regions += r
+	}
+	if regions != s.Reads {
+		t.Errorf("regions count %d reads, expected %d", regions, s.Reads)
+	}
+	// 63 degrees of freedom; a uniform spread is very unlikely to be over 150
+	if chi := s.RegionChiSquare(); chi > 150 {
+		t.Errorf("reads are not spread over the ByteMap: chi-square %f", chi)
+	}
+	if r := reduced.Stats().OutsideRate(); r < .9 || r > .97 {
+		t.Errorf("expected about 15/16 of reads outside the reduced table, got %f", r)
+	}
+
+	s.Add(reduced.Stats())
+	if s.Hashes != 2000 {
+		t.Errorf("expected 2000 hashes added, got %d", s.Hashes)
+	}
+	full.Reset()
+	if full.Stats().Reads != 0 {
+		t.Error("Reset did not clear the counts")
+	}
+	if _, err := full.PoW(hash8[:], 1); !errors.Is(err, ErrHashLength) {
+		t.Errorf("expected ErrHashLength, got %v", err)
+	}
+}
+
+var hash8 [8]byte
+
+func TestNewInstrumented_Bits(t *testing.T) {
+	lx, err := New(Options{Loops: 8, Bits: 12, Passes: 6, Store: NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	for _, bits := range []int{7, 13, -1} {
+		if _, err := NewInstrumented(lx, bits); !errors.Is(err, ErrBitsOutOfRange) {
+			t.Errorf("%d bits: expected ErrBitsOutOfRange, got %v", bits, err)
+		}
+	}
+}
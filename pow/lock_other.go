@@ -0,0 +1,18 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+//go:build !unix
+
+package pow
+
+import (
+	"context"
+)
+
+// lockFile is only supported on unix systems.  Elsewhere it only checks the context.
+func lockFile(ctx context.Context, filename string) (unlock func() error, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return func() error { return nil }, nil
+}
@@ -0,0 +1,33 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"context"
+	"log/slog"
+)
+
+// discardHandler drops every record, and tells slog so before any work is done
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var discardLogger = slog.New(discardHandler{})
+
+// DiscardLogger
+// Returns a logger that logs nothing.  Used by default wherever a logger is not
+// provided, so the library is silent unless asked otherwise.
+func DiscardLogger() *slog.Logger {
+	return discardLogger
+}
+
+// loggerOrDiscard returns the logger, or the DiscardLogger if it is nil
+func loggerOrDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return discardLogger
+	}
+	return logger
+}
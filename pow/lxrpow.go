@@ -2,14 +2,28 @@
 package pow
 
 import (
+	"context"
 	"encoding/binary"
+	"fmt"
+	"log/slog"
 )
 
 type LxrPow struct {
-	Loops   int    // The number of loops translating the ByteMap
-	ByteMap []byte // Integer Offsets
-	MapSize uint64 // Size of the translation table (must be a factor of 256)
-	Passes  int    // Passes to generate the rand table
+	Loops   int        // The number of loops translating the ByteMap
+	ByteMap []byte     // Integer Offsets
+	MapSize uint64     // Size of the translation table (must be a factor of 256)
+	Passes  int        // Passes to generate the rand table
+	Store   TableStore // Where the ByteMap is cached once generated
+
+	Generator  GeneratorVersion // Generator used to build the ByteMap (0 is GeneratorLegacy)
+	Progress   ProgressFunc     // Reports progress while generating the ByteMap
+	Logger     *slog.Logger     // Logs loading and generating the ByteMap; nil logs nothing
+	TrustCache bool             // Skip the SHA-256 check of cached ByteMaps
+	Mmap       bool             // Memory map the ByteMap from the store if it supports it
+	table      []byte           // The ByteMap with room for its TableHeader in front
+	unmap      func() error     // Releases a memory mapped ByteMap
+	release    func() error     // Releases the LxrPow's reference to a shared ByteMap
+	owned      bool             // True if table was allocated by GenerateTableContext and is not shared
 }
 
 // NewLxrPow
@@ -24,22 +38,131 @@ type LxrPow struct {
 //
 // Any change to Loops, Bits, or Passes will map the PoW to a completely different
 // space.
+//
+// NewLxrPow panics on any error; New should be used by anything that must survive
+// a bad configuration or a missing cache directory.
 func NewLxrPow(Loops, Bits, Passes int) *LxrPow {
 	lx := new(LxrPow)
 	lx.Init(Loops, Bits, Passes)
 	return lx
 }
 
+// Options
+// The parameters used to construct an LxrPow instance with New
+type Options struct {
+	Loops  int // The number of loops translating the ByteMap
+	Bits   int // Number of bits used to create the ByteMap (30 bits creates a 1 GB ByteMap)
+	Passes int // Number of shuffles used to randomize the ByteMap
+
+	// Where the ByteMap is cached.  If Store is nil, a DirStore rooted at TableDir
+	// is used.  If TableDir is also empty, LXRPOW_TABLE_DIR or ~/.lxrpow is used.
+	Store    TableStore
+	TableDir string
+
+	// TrustCache skips the SHA-256 check of the ByteMap when it is loaded from the
+	// store.  The header is still checked.  Only use this on trusted hosts.
+	TrustCache bool
+
+	// Mmap memory maps the ByteMap from the store (read only, shared) rather than
+	// loading a private copy onto the heap, so processes on the same host share one
+	// copy in the page cache.  If the store or platform can't map tables, the ByteMap
+	// is loaded onto the heap.  Call Close to release the mapping.
+	Mmap bool
+
+	// Generator selects how the ByteMap is built.  Each generator builds a different
+	// ByteMap, so changing it maps the PoW to a different space.  0 is GeneratorLegacy.
+	Generator GeneratorVersion
+
+	// Progress, if set, is called as the ByteMap is generated
+	Progress ProgressFunc
+
+	// Logger logs loading and generating the ByteMap.  If nil, nothing is logged.
+	Logger *slog.Logger
+}
+
+// New
+//
+// Return a new instance of the LxrPow work function built from the given options.
+// Unlike NewLxrPow, errors in the options or in loading the ByteMap are returned
+// rather than causing a panic.
+//
+// The ByteMap is shared with any other LxrPow in the process using the same Bits,
+// Passes, Generator and store, so it must not be modified.  Call Close when done
+// with the LxrPow so the ByteMap can be released.
+func New(opts Options) (*LxrPow, error) {
+	return NewContext(context.Background(), opts)
+}
+
+// NewContext
+// Returns a new LxrPow as New does, but stops loading or generating the ByteMap
+// when the context is done, returning the context's error.  Generating a 4 GB
+// ByteMap can take minutes, so anything that must shut down promptly should use it.
+func NewContext(ctx context.Context, opts Options) (*LxrPow, error) {
+	lx := new(LxrPow)
+	if err := lx.init(ctx, opts); err != nil {
+		return nil, err
+	}
+	return lx, nil
+}
+
+// Close
+// Releases the ByteMap.  Instances built with the same Bits, Passes, Generator and
+// store share one ByteMap; it is released when the last of them is closed, and
+// unmapped then if it was memory mapped.  The LxrPow must not be used afterwards.
+func (lx *LxrPow) Close() error {
+	lx.ByteMap, lx.table, lx.owned = nil, nil, false
+	if lx.release != nil { // Shared ByteMaps are unmapped when the last user releases them
+		release := lx.release
+		lx.release, lx.unmap = nil, nil
+		return release()
+	}
+	if lx.unmap == nil {
+		return nil
+	}
+	unmap := lx.unmap
+	lx.unmap = nil
+	return unmap()
+}
+
 // LxrPoW() returns a 64 byte value indicating the proof of work of a hash
 // This is designed to allow the use of any hash function, but make the grading
 // of the proof of work dependent on the random byte access limits of LXRHash.
 //
 // The bigger uint64, the more PoW it represents.  The first byte is the
 // number of leading bytes of FF, followed by the leading "non FF" bytes of the pow.
+//
+// LxrPoW panics if the hash is not 32 bytes long; use PoW to get an error instead.
+// Input of any other kind, such as digests of other lengths or raw preimages, can
+// be mined with LxrPoWData, or folded to 32 bytes with Absorb.
 func (lx LxrPow) LxrPoW(hash []byte, nonce uint64) (pow uint64) {
+	pow, err := lx.PoW(hash, nonce)
+	if err != nil {
+		panic(err)
+	}
+	return pow
+}
+
+// PoW
+// Computes the same proof of work as LxrPoW, but returns an error if the hash
+// provided is not 32 bytes long.
+func (lx LxrPow) PoW(hash []byte, nonce uint64) (pow uint64, err error) {
+	_, state, err := lx.translate(hash, nonce)
+	if err != nil {
+		return 0, err
+	}
+	return mixState(hash, state), nil // Return the pow of the sha256 of the translated hash
+}
+
+// translate mixes the nonce into the hash, and makes the loops through the ByteMap,
+// returning the translated hash and the state that is mixed with the hash one
+// last time to give the PoW
+func (lx LxrPow) translate(hash []byte, nonce uint64) (LHash [40]byte, state uint64, err error) {
 	mask := lx.MapSize - 1
 
-	LHash, state := lx.mix(hash, nonce)
+	LHash, state, err = lx.mix(hash, nonce)
+	if err != nil {
+		return LHash, 0, err
+	}
 
 	// Make the specified "loops" through the LHash.  This is 40 bytes; 32 from the sha256 and
 	// 8 bytes from the trailing part of the hash.  Keeping or not keeping the trailing 8 only
@@ -50,18 +173,89 @@ func (lx LxrPow) LxrPoW(hash []byte, nonce uint64) (pow uint64) {
 			LHash[j] = byte(state)
 		}
 	}
+	return LHash, state, nil
+}
 
-	_, state = lx.mix(hash, state)
-	return state // Return the pow of the sha256 of the translated hash
+// Trace
+// Computes LxrPoW, calling visit with the index of every ByteMap read in the order
+// they are made.  It is much slower than LxrPoW, and is meant for profiling how the
+// ByteMap is accessed.
+func (lx LxrPow) Trace(hash []byte, nonce uint64, visit func(index uint64)) (pow uint64, err error) {
+	mask := lx.MapSize - 1
+
+	LHash, state, err := lx.mix(hash, nonce)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < lx.Loops; i++ {
+		for j, v := range LHash {
+			visit(state & mask)
+			state = state<<17 ^ state>>7 ^ uint64(lx.ByteMap[state&mask]^v)
+			LHash[j] = byte(state)
+		}
+	}
+	return mixState(hash, state), nil
+}
+
+// LxrPoWMeets
+// Computes the proof of work of the hash and nonce, and reports if it beats the
+// limit (is strictly greater than it).  This is the test hashers apply to decide
+// if a nonce is a solution.  It costs as much as PoW: every word of the final mix
+// feeds the top bits of the PoW, so the mix cannot be cut short once the limit is
+// known.
+//
+// A hash that is not 32 bytes long never meets the limit.
+func (lx LxrPow) LxrPoWMeets(hash []byte, nonce, limit uint64) (pow uint64, ok bool) {
+	pow, err := lx.PoW(hash, nonce)
+	if err != nil {
+		return 0, false
+	}
+	return pow, pow > limit
+}
+
+// Verify
+// Reports if the claimed proof of work is the proof of work of the hash and nonce.
+// This is the test validators apply to submissions.  A hash that is not 32 bytes
+// long never verifies.
+func (lx LxrPow) Verify(hash []byte, nonce, claimedPow uint64) bool {
+	pow, err := lx.PoW(hash, nonce)
+	return err == nil && pow == claimedPow
+}
+
+func (lx LxrPow) mix(hash []byte, nonce uint64) (newHash [40]byte, state uint64, err error) {
+	return Mix(hash, nonce)
 }
 
-func (lx LxrPow) mix(hash []byte, nonce uint64) (newHash [40]byte, state uint64) {
+// Mix
+// The first and last step of LxrPoW.  Mixes the nonce into the 32 byte hash,
+// returning the 40 byte mixed hash the ByteMap translations are made over, and
+// the starting state.  It does not depend on the ByteMap.
+func Mix(hash []byte, nonce uint64) (newHash [40]byte, state uint64, err error) {
 
 	if len(hash) != 32 {
-		panic("must provide a 32 byte hash")
+		return newHash, 0, fmt.Errorf("%w: got %d bytes", ErrHashLength, len(hash))
 	}
 
-	var array [5]uint64
+	array, state := mixWords(hash, nonce)
+	for i, a := range array {
+		binary.BigEndian.PutUint64(newHash[i*8:], a)
+		state = a ^ state<<3 ^ state>>5
+	}
+	return newHash, state, nil
+}
+
+// mixState returns only the state of Mix.  The hash must be 32 bytes long.
+func mixState(hash []byte, nonce uint64) (state uint64) {
+	array, state := mixWords(hash, nonce)
+	for _, a := range array {
+		state = a ^ state<<3 ^ state>>5
+	}
+	return state
+}
+
+// mixWords mixes the nonce into the words of the hash for Mix.  The hash must be
+// 32 bytes long.
+func mixWords(hash []byte, nonce uint64) (array [5]uint64, state uint64) {
 	state = nonce
 	array[0] = nonce
 	for i := 0; i < 4; i++ {
@@ -74,10 +268,5 @@ func (lx LxrPow) mix(hash []byte, nonce uint64) (newHash [40]byte, state uint64)
 		array[j] ^= state
 		state = array[j]<<11 ^ state>>7 ^ (cnt+17)<<5
 	}
-
-	for i, a := range array {
-		binary.BigEndian.PutUint64(newHash[i*8:], a)
-		state = a ^ state<<3 ^ state>>5
-	}
-	return newHash, state
+	return array, state
 }
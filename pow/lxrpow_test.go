@@ -3,9 +3,13 @@
 package pow
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -106,7 +110,7 @@ func Test_StartValue(t *testing.T) {
 		Hash = sha256.Sum256(Hash[:])	
 		var last, d, diff, under, cnt uint64
 		for i := 0; i < 100000; i++ {
-			_, state := lx.mix(Hash[:],uint64(i))
+			_, state, _ := lx.mix(Hash[:],uint64(i))
 			//state := binary.BigEndian.Uint64(Hash[:])
 			//Hash = sha256.Sum256(Hash[:])
 			
@@ -129,3 +133,69 @@ func Test_StartValue(t *testing.T) {
 		fmt.Printf("Under 1k: %d \n", under)
 	}
 }
+
+func TestNew_Errors(t *testing.T) {
+	if _, err := New(Options{Loops: 16, Bits: 33, Passes: 6}); !errors.Is(err, ErrBitsOutOfRange) {
+		t.Errorf("expected ErrBitsOutOfRange, got %v", err)
+	}
+
+	lx, err := New(Options{Loops: 16, Bits: 8, Passes: 6, Store: NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	if _, err := lx.PoW(make([]byte, 31), 1); !errors.Is(err, ErrHashLength) {
+		t.Errorf("expected ErrHashLength, got %v", err)
+	}
+	hash := sha256.Sum256([]byte("hash"))
+	pow, err := lx.PoW(hash[:], 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pow != lx.LxrPoW(hash[:], 1) {
+		t.Error("PoW and LxrPoW disagree")
+	}
+}
+
+func TestNew_Logger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	lx, err := New(Options{Loops: 16, Bits: 8, Passes: 6, Store: NewMemStore(), Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	if !strings.Contains(buf.String(), "table="+lx.TableName()) {
+		t.Errorf("expected the table name to be logged, got:\n%s", buf.String())
+	}
+}
+
+func TestLxrPoWMeets_Verify(t *testing.T) {
+	lx, err := New(Options{Loops: 16, Bits: 12, Passes: 6, Store: NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	hash := sha256.Sum256([]byte("meets"))
+	for nonce := uint64(0); nonce < 1000; nonce++ {
+		want := lx.LxrPoW(hash[:], nonce)
+		pow, ok := lx.LxrPoWMeets(hash[:], nonce, want)
+		if pow != want || ok {
+			t.Fatalf("nonce %d: a pow must not meet a limit equal to itself", nonce)
+		}
+		if want > 0 {
+			if _, ok := lx.LxrPoWMeets(hash[:], nonce, want-1); !ok {
+				t.Fatalf("nonce %d: pow %x does not meet limit %x", nonce, want, want-1)
+			}
+		}
+		if !lx.Verify(hash[:], nonce, want) || lx.Verify(hash[:], nonce, want^1) {
+			t.Fatalf("nonce %d: Verify is wrong", nonce)
+		}
+	}
+	if _, ok := lx.LxrPoWMeets(hash[:16], 1, 0); ok {
+		t.Error("a short hash must never meet the limit")
+	}
+	if lx.Verify(hash[:16], 1, 0) {
+		t.Error("a short hash must never verify")
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Manager
+// Holds the PoW algorithms a node needs as the network's settings change.  Algorithms
+// for upcoming settings are built in the background, so that when their activation
+// block arrives, hashers can switch to them without waiting on a ByteMap.  Builds
+// are made one at a time, since each may need a large ByteMap in memory.
+type Manager struct {
+	opts     Options                      // How algorithms are built; the PoW parameters are ignored
+	mutex    sync.Mutex                   // Protects algs
+	algs     map[AlgorithmKey]*managedAlg // Every algorithm built or being built
+	building sync.Mutex                   // Held while an algorithm is being built
+}
+
+// managedAlg is an algorithm held by a Manager
+type managedAlg struct {
+	ready   chan struct{} // Closed once the algorithm is built, or failed to build
+	alg     Algorithm
+	err     error
+	added   bool // Given to Add, so the caller may still use it after it is retired
+	leases  int  // Count of leases not yet released; protected by the Manager's mutex
+	retired bool // Dropped by Retire; closed once built and no longer leased
+}
+
+// Lease
+// An algorithm handed out by a Manager.  The Manager does not close the algorithm
+// while it is leased, even once it is retired, so a hasher or validator in the middle
+// of a hash is never left with a released ByteMap.  Release must be called once the
+// algorithm is no longer used.  A Lease without a Manager just holds Alg, and a nil
+// Lease holds nothing.
+type Lease struct {
+	Alg      Algorithm
+	m        *Manager
+	a        *managedAlg
+	released atomic.Bool
+}
+
+// Retain
+// Returns another lease on the same algorithm, to be released separately.  The
+// Lease must not have been released.
+func (l *Lease) Retain() *Lease {
+	if l == nil {
+		return nil
+	}
+	if l.a == nil {
+		return &Lease{Alg: l.Alg}
+	}
+	l.m.mutex.Lock()
+	defer l.m.mutex.Unlock()
+	l.a.leases++
+	return &Lease{Alg: l.Alg, m: l.m, a: l.a}
+}
+
+// Release
+// Gives up the lease.  If it was the last lease of a retired algorithm, the
+// algorithm is closed.  Releasing a lease again does nothing.
+func (l *Lease) Release() {
+	if l == nil || l.a == nil || l.released.Swap(true) {
+		return
+	}
+	l.m.release(l.a)
+}
+
+// NewManager
+// Returns a Manager building algorithms with the given options.  Only the store,
+// logging and ByteMap options are used; the PoW parameters come from each key.
+func NewManager(opts Options) *Manager {
+	return &Manager{opts: opts, algs: make(map[AlgorithmKey]*managedAlg)}
+}
+
+// Add
+// Adds an algorithm that is already built, such as the one a node started with.
+// If the Manager already has an algorithm for the key, the one given is ignored.
+func (m *Manager) Add(alg Algorithm) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, exists := m.algs[alg.Key()]; exists {
+		return
+	}
+	a := &managedAlg{ready: make(chan struct{}), alg: alg, added: true}
+	close(a.ready)
+	m.algs[alg.Key()] = a
+}
+
+// Prepare
+// Starts building the algorithm for the key in the background, if the Manager does
+// not already have it.
+func (m *Manager) Prepare(key AlgorithmKey) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.start(key)
+}
+
+// Ready reports if the algorithm for the key is built and can be used without waiting
+func (m *Manager) Ready(key AlgorithmKey) bool {
+	m.mutex.Lock()
+	a, ok := m.algs[key]
+	m.mutex.Unlock()
+	if !ok {
+		return false
+	}
+	select {
+	case <-a.ready:
+		return a.err == nil
+	default:
+		return false
+	}
+}
+
+// Get
+// Returns a lease on the algorithm for the key, waiting for it to be built if it
+// is not ready.  The lease must be released once the algorithm is no longer used.
+// If the build fails, the error is returned and the next call tries again.
+func (m *Manager) Get(key AlgorithmKey) (*Lease, error) {
+	m.mutex.Lock()
+	a := m.start(key)
+	a.leases++ // so it is not closed while it is built, if it is retired meanwhile
+	m.mutex.Unlock()
+	<-a.ready
+	lease := &Lease{Alg: a.alg, m: m, a: a}
+	if a.err != nil {
+		lease.Release()
+		return nil, a.err
+	}
+	return lease, nil
+}
+
+// Retire
+// Drops every algorithm whose key is not one of the keys to keep, so the memory of
+// its ByteMap can be released.  Algorithms the Manager built are closed once they
+// are built and their last lease is released; those given to Add are only
+// forgotten, as their owner may still use them.
+func (m *Manager) Retire(keep []AlgorithmKey) error {
+	keys := make(map[AlgorithmKey]bool, len(keep))
+	for _, key := range keep {
+		keys[key] = true
+	}
+	var unused []*managedAlg
+	m.mutex.Lock()
+	for key, a := range m.algs {
+		if keys[key] {
+			continue
+		}
+		delete(m.algs, key)
+		a.retired = true
+		if a.leases == 0 {
+			unused = append(unused, a)
+		}
+	}
+	m.mutex.Unlock()
+
+	var errs []error
+	for _, a := range unused {
+		errs = append(errs, closeManaged(a))
+	}
+	return errors.Join(errs...)
+}
+
+// release gives up a lease on the algorithm, closing it if it was the last lease
+// of a retired algorithm
+func (m *Manager) release(a *managedAlg) {
+	m.mutex.Lock()
+	a.leases--
+	unused := a.retired && a.leases == 0
+	m.mutex.Unlock()
+	if unused {
+		if err := closeManaged(a); err != nil {
+			loggerOrDiscard(m.opts.Logger).Warn("could not close retired PoW algorithm", "error", err)
+		}
+	}
+}
+
+// closeManaged closes a retired algorithm the Manager built itself, once it is built
+func closeManaged(a *managedAlg) error {
+	select {
+	case <-a.ready:
+	default: // Close the algorithm once it is built, without waiting here
+		go func() {
+			<-a.ready
+			closeManaged(a)
+		}()
+		return nil
+	}
+	if a.alg == nil || a.added {
+		return nil
+	}
+	return a.alg.Close()
+}
+
+// Watch
+// Calls schedule every interval, prepares the algorithm for every key it returns,
+// and retires the rest.  schedule should return the keys of every settings that
+// submissions may still be checked against, and of any upcoming settings.
+// Algorithms still leased are closed once released.  Watch returns when stop is
+// closed.
+func (m *Manager) Watch(schedule func() []AlgorithmKey, interval time.Duration, stop <-chan struct{}) {
+	for {
+		keys := schedule()
+		for _, key := range keys {
+			m.Prepare(key)
+		}
+		if err := m.Retire(keys); err != nil {
+			loggerOrDiscard(m.opts.Logger).Warn("could not retire PoW algorithms", "error", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Close
+// Waits for any builds in progress, then closes every algorithm the Manager built,
+// leased or not.  Algorithms given to Add are only forgotten, as their owner may
+// still use them.  Leases from Get must not be used afterwards.
+func (m *Manager) Close() error {
+	m.mutex.Lock()
+	algs := m.algs
+	m.algs = make(map[AlgorithmKey]*managedAlg)
+	m.mutex.Unlock()
+
+	var errs []error
+	for _, a := range algs {
+		<-a.ready
+		if a.alg != nil && !a.added {
+			errs = append(errs, a.alg.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// start returns the managed algorithm for the key, starting its build if needed.
+// The mutex must be held.
+func (m *Manager) start(key AlgorithmKey) *managedAlg {
+	if a, exists := m.algs[key]; exists {
+		return a
+	}
+	a := &managedAlg{ready: make(chan struct{})}
+	m.algs[key] = a
+
+	go func() {
+		m.building.Lock()
+		defer m.building.Unlock()
+		log := loggerOrDiscard(m.opts.Logger).With("algorithm", key)
+		log.Info("preparing PoW algorithm")
+		a.alg, a.err = NewAlgorithm(key, m.opts)
+		if a.err != nil {
+			log.Error("could not prepare PoW algorithm", "error", a.err)
+			m.mutex.Lock()
+			if m.algs[key] == a { // Let the next Prepare or Get try again
+				delete(m.algs, key)
+			}
+			m.mutex.Unlock()
+		}
+		close(a.ready)
+	}()
+	return a
+}
@@ -0,0 +1,158 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestManager(t *testing.T) {
+	m := NewManager(Options{Store: NewMemStore(), Loops: 99})
+	key := AlgorithmKey{ID: AlgorithmLxrPoW, Version: uint16(GeneratorLegacy), Loops: 8, Bits: 10, Passes: 6}
+
+	lease, err := m.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lease.Release()
+	if lease.Alg.Key() != key {
+		t.Errorf("key is %v, expected %v", lease.Alg.Key(), key)
+	}
+	if !m.Ready(key) {
+		t.Error("algorithm is not ready after Get")
+	}
+	again, _ := m.Get(key)
+	if again.Alg != lease.Alg {
+		t.Error("Get built the algorithm twice")
+	}
+	again.Release()
+
+	// Algorithms that were already built are used as they are
+	lx, err := New(Options{Loops: 8, Bits: 12, Passes: 6, Store: NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	m.Add(lx)
+	if got, _ := m.Get(lx.Key()); got.Alg != Algorithm(lx) {
+		t.Error("Get did not return the algorithm added")
+	}
+
+	built := lease.Alg.(*LxrPow)
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Ready(key) {
+		t.Error("algorithm is ready after Close")
+	}
+	if built.ByteMap != nil {
+		t.Error("algorithm the Manager built was not closed")
+	}
+	// Algorithms given to Add are not closed, so their owner can still use them
+	if lx.ByteMap == nil {
+		t.Error("added algorithm was closed")
+	}
+}
+
+func TestManager_Prepare(t *testing.T) {
+	m := NewManager(Options{Store: NewMemStore()})
+	defer m.Close()
+	keys := []AlgorithmKey{
+		{ID: AlgorithmLxrPoW, Version: uint16(GeneratorLegacy), Loops: 8, Bits: 12, Passes: 6},
+		{ID: AlgorithmLxrPoW, Version: uint16(GeneratorParallel), Loops: 8, Bits: 12, Passes: 6},
+	}
+	stop, watching := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(watching)
+		m.Watch(func() []AlgorithmKey { return keys }, time.Millisecond, stop)
+	}()
+	defer func() { // Watch must stop before the Manager is closed, or it may prepare again
+		close(stop)
+		<-watching
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for _, key := range keys {
+		for !m.Ready(key) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%v was never prepared", key)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestManager_Errors(t *testing.T) {
+	m := NewManager(Options{Store: NewMemStore()})
+	defer m.Close()
+	key := AlgorithmKey{ID: AlgorithmLxrPoW, Version: 999, Bits: 8}
+	for i := 0; i < 2; i++ { // A failed build is tried again
+		if _, err := m.Get(key); !errors.Is(err, ErrUnknownGenerator) {
+			t.Errorf("got %v, expected %v", err, ErrUnknownGenerator)
+		}
+		if m.Ready(key) {
+			t.Error("a failed algorithm is ready")
+		}
+	}
+}
+
+func TestManager_Retire(t *testing.T) {
+	m := NewManager(Options{Store: NewMemStore()})
+	defer m.Close()
+	old := AlgorithmKey{ID: AlgorithmLxrPoW, Version: uint16(GeneratorLegacy), Loops: 8, Bits: 10, Passes: 6}
+	cur := AlgorithmKey{ID: AlgorithmLxrPoW, Version: uint16(GeneratorLegacy), Loops: 16, Bits: 10, Passes: 6}
+	leased, err := m.Get(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lx, err := New(Options{Loops: 8, Bits: 12, Passes: 6, Store: NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	m.Add(lx)
+	current, err := m.Get(cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.Release()
+
+	if err := m.Retire([]AlgorithmKey{cur}); err != nil {
+		t.Fatal(err)
+	}
+	if m.Ready(old) || m.Ready(lx.Key()) {
+		t.Error("a retired algorithm is still ready")
+	}
+	if !m.Ready(cur) {
+		t.Error("an algorithm kept was retired")
+	}
+	// Algorithms given to Add are not closed, so their owner can still use them
+	if lx.ByteMap == nil {
+		t.Error("added algorithm was closed")
+	}
+
+	// A retired algorithm is closed once its last lease is released
+	held := leased.Retain()
+	leased.Release()
+	leased.Release() // Releasing twice must not release the retained lease
+	if held.Alg.(*LxrPow).ByteMap == nil {
+		t.Fatal("retired algorithm was closed while leased")
+	}
+	if _, err := held.Alg.PoW(make([]byte, 32), 1); err != nil {
+		t.Error(err)
+	}
+	held.Release()
+	if held.Alg.(*LxrPow).ByteMap != nil {
+		t.Error("retired algorithm was not closed once released")
+	}
+
+	// Leases without a Manager, or nil leases, do nothing
+	(&Lease{Alg: lx}).Retain().Release()
+	var none *Lease
+	none.Retain().Release()
+	if lx.ByteMap == nil {
+		t.Error("a lease without a Manager closed its algorithm")
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+// Package memhard measures the time-memory tradeoff of LxrPoW: how much faster a
+// miner keeping only part of the ByteMap can hash, and how many of the PoWs it
+// computes are then wrong.  If LxrPoW is bound by random ByteMap reads, a smaller
+// table is faster only because it fits in cache, and almost every PoW it gives is
+// wrong, so no useful speedup remains.
+package memhard
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+
+	"github.com/pegnet/LXRPow/pow"
+)
+
+// Config
+// How an experiment is run
+type Config struct {
+	TableBits []int         // Reduced table sizes to try; nil tries every 2 bits below the Bits of the LxrPow, down to 8
+	Duration  time.Duration // How long to hash with each table size; 0 uses DefaultDuration
+	Samples   int           // Hashes checked against LxrPoW for each table size; 0 uses DefaultSamples
+}
+
+// DefaultDuration is how long each table size is hashed with
+const DefaultDuration = 2 * time.Second
+
+// DefaultSamples is the number of hashes checked against LxrPoW for each table size
+const DefaultSamples = 10000
+
+// Result
+// How one table size compares to the full ByteMap
+type Result struct {
+	TableBits    int     `json:"tableBits"`
+	TableBytes   uint64  `json:"tableBytes"`
+	Fraction     float64 `json:"fraction"` // Fraction of the full ByteMap kept
+	HashesPerSec float64 `json:"hashesPerSec"`
+	Speedup      float64 `json:"speedup"`     // Hash rate relative to the full ByteMap
+	OutsideRate  float64 `json:"outsideRate"` // Fraction of reads that fell outside the table
+	Correct      float64 `json:"correct"`     // Fraction of sampled PoWs that matched LxrPoW
+	Effective    float64 `json:"effective"`   // Speedup times Correct: the rate of right PoWs relative to the full ByteMap
+}
+
+// Report
+// The results of an experiment on one LxrPow
+type Report struct {
+	Loops           int      `json:"loops"`
+	Bits            int      `json:"bits"`
+	Passes          int      `json:"passes"`
+	ReadsPerHash    float64  `json:"readsPerHash"`
+	RegionChiSquare float64  `json:"regionChiSquare"` // Spread of reads over the ByteMap; about 63 if uniform
+	Results         []Result `json:"results"`         // The full ByteMap first, then each reduced table
+}
+
+// Run
+// Hashes with the full ByteMap and with each reduced table for the configured
+// duration on one goroutine, and checks a sample of the PoWs of each against
+// LxrPoW.
+func Run(lx *pow.LxrPow, cfg Config) (Report, error) {
+	if cfg.Duration <= 0 {
+		cfg.Duration = DefaultDuration
+	}
+	if cfg.Samples <= 0 {
+		cfg.Samples = DefaultSamples
+	}
+	bits := lx.Bits()
+	if cfg.TableBits == nil {
+		for b := bits - 2; b >= 8; b -= 2 {
+			cfg.TableBits = append(cfg.TableBits, b)
+		}
+	}
+	r := Report{Loops: lx.Loops, Bits: bits, Passes: lx.Passes}
+
+	for _, tableBits := range append([]int{bits}, cfg.TableBits...) {
+		in, err := pow.NewInstrumented(lx, tableBits)
+		if err != nil {
+			return r, err
+		}
+		result := measure(lx, in, cfg)
+		if len(r.Results) == 0 {
+			stats := in.Stats()
+			r.ReadsPerHash = stats.ReadsPerHash()
+			r.RegionChiSquare = stats.RegionChiSquare()
+		} else if full := r.Results[0].HashesPerSec; full > 0 {
+			result.Speedup = result.HashesPerSec / full
+		}
+		result.Effective = result.Speedup * result.Correct
+		r.Results = append(r.Results, result)
+	}
+	return r, nil
+}
+
+// measure hashes with the instrumented LxrPow for the configured time, then checks
+// a sample of its PoWs against LxrPoW
+func measure(lx *pow.LxrPow, in *pow.Instrumented, cfg Config) Result {
+	result := Result{
+		TableBits:  in.TableBits(),
+		TableBytes: uint64(1) << in.TableBits(),
+		Fraction:   float64(uint64(1)<<in.TableBits()) / float64(lx.MapSize),
+		Speedup:    1,
+	}
+
+	hash := sha256.Sum256([]byte("memhard"))
+	nonce := binary.BigEndian.Uint64(hash[:])
+	var hashes uint64
+	start := time.Now()
+	for time.Since(start) < cfg.Duration {
+		for j := 0; j < 64; j++ { // Check the time in batches
+			nonce++
+			in.LxrPoW(hash[:], nonce)
+		}
+		hashes += 64
+	}
+	result.HashesPerSec = float64(hashes) / time.Since(start).Seconds()
+	result.OutsideRate = in.Stats().OutsideRate()
+
+	correct := 0
+	for i := 0; i < cfg.Samples; i++ {
+		nonce++
+		if in.LxrPoW(hash[:], nonce) == lx.LxrPoW(hash[:], nonce) {
+			correct++
+		}
+	}
+	result.Correct = float64(correct) / float64(cfg.Samples)
+	return result
+}
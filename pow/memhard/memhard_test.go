@@ -0,0 +1,48 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package memhard
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pegnet/LXRPow/pow"
+)
+
+func TestRun(t *testing.T) {
+	lx, err := pow.New(pow.Options{Loops: 4, Bits: 14, Passes: 6, Store: pow.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	r, err := Run(lx, Config{Duration: 20 * time.Millisecond, Samples: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Bits != 14 || r.Loops != 4 || r.ReadsPerHash != 4*40 {
+		t.Errorf("wrong parameters reported: %+v", r)
+	}
+	if len(r.Results) != 4 { // 14 bits, then 12, 10 and 8
+		t.Fatalf("expected 4 results, got %d", len(r.Results))
+	}
+	full := r.Results[0]
+	if full.TableBits != 14 || full.Fraction != 1 || full.Correct != 1 || full.Speedup != 1 || full.OutsideRate != 0 {
+		t.Errorf("the full ByteMap is not exact: %+v", full)
+	}
+	for _, res := range r.Results[1:] {
+		if res.HashesPerSec <= 0 {
+			t.Errorf("%d bits: no hashing measured", res.TableBits)
+		}
+		if res.Correct > .01 {
+			t.Errorf("%d bits: %f of PoWs were right with a reduced table", res.TableBits, res.Correct)
+		}
+		if res.OutsideRate < 1-res.Fraction-.05 {
+			t.Errorf("%d bits: outside rate %f for a table fraction %f", res.TableBits, res.OutsideRate, res.Fraction)
+		}
+	}
+
+	if _, err := Run(lx, Config{TableBits: []int{20}, Duration: time.Millisecond, Samples: 1}); !errors.Is(err, pow.ErrBitsOutOfRange) {
+		t.Errorf("expected ErrBitsOutOfRange, got %v", err)
+	}
+}
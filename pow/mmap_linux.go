@@ -0,0 +1,36 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+//go:build linux
+
+package pow
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the whole file read only and shared, so every process mapping
+// the same table shares its pages in the page cache.
+func mmapFile(filename string) (data []byte, unmap func() error, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close() // The mapping stays valid after the file is closed
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	size := fi.Size()
+	if size <= 0 || int64(int(size)) != size {
+		return nil, nil, fmt.Errorf("cannot map %s: size %d", filename, size)
+	}
+	data, err = syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot map %s: %w", filename, err)
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,17 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+//go:build !linux
+
+package pow
+
+import (
+	"errors"
+)
+
+var errMmapUnsupported = errors.New("memory mapped tables are only supported on linux")
+
+// mmapFile is only supported on Linux.  Elsewhere tables are loaded onto the heap.
+func mmapFile(filename string) (data []byte, unmap func() error, err error) {
+	return nil, nil, errMmapUnsupported
+}
@@ -0,0 +1,106 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// Pow256
+// A 256 bit proof of work.  At realistic difficulties the 64 bit PoW is mostly
+// leading FF bytes, so many submissions tie; the 256 bit PoW leaves room to rank
+// them.  The first 8 bytes are the 64 bit PoW (big endian), so the two modes
+// always agree on the ordering of different 64 bit values.  The other 24 bytes
+// are the start of the SHA-256 of the translated hash and the state after the
+// loops through the ByteMap.  The 64 bit PoW is a function of the state alone,
+// so bits drawn from the state could add almost nothing to it; the translated
+// hash is independent of it, so nonces with equal 64 bit PoWs almost never tie.
+//
+// Values are ordered as big endian numbers; the bigger, the more work.
+type Pow256 [32]byte
+
+// Pow256FromUint64 returns the 256 bit value with the 64 bit value v leading, and
+// all the bits after it zero.  Used to extend a 64 bit difficulty.
+func Pow256FromUint64(v uint64) (p Pow256) {
+	binary.BigEndian.PutUint64(p[:], v)
+	return p
+}
+
+// Cmp returns -1 if p is less than q, 0 if they are equal, and 1 if p is greater
+func (p Pow256) Cmp(q Pow256) int {
+	return bytes.Compare(p[:], q[:])
+}
+
+// Less reports if p represents less work than q
+func (p Pow256) Less(q Pow256) bool {
+	return p.Cmp(q) < 0
+}
+
+// Beats reports if p is strictly greater than the limit, as a 64 bit PoW must be
+// to meet a limit
+func (p Pow256) Beats(limit Pow256) bool {
+	return p.Cmp(limit) > 0
+}
+
+// Uint64 returns the leading 64 bits, which is the 64 bit PoW
+func (p Pow256) Uint64() uint64 {
+	return binary.BigEndian.Uint64(p[:])
+}
+
+// IsZero reports if every bit is zero
+func (p Pow256) IsZero() bool {
+	return p == Pow256{}
+}
+
+func (p Pow256) String() string {
+	return hex.EncodeToString(p[:])
+}
+
+// Algorithm256
+// An Algorithm that can also give its PoW as a 256 bit value
+type Algorithm256 interface {
+	Algorithm
+	PoW256(hash []byte, nonce uint64) (pow Pow256, err error)
+	Verify256(hash []byte, nonce uint64, claimedPow Pow256) bool
+}
+
+var _ Algorithm256 = (*LxrPow)(nil)
+
+// LxrPoW256
+// Computes the proof of work of the hash and nonce as a 256 bit value.  The first
+// 8 bytes are exactly LxrPoW(hash, nonce).
+//
+// LxrPoW256 panics if the hash is not 32 bytes long; use PoW256 to get an error instead.
+func (lx LxrPow) LxrPoW256(hash []byte, nonce uint64) Pow256 {
+	pow, err := lx.PoW256(hash, nonce)
+	if err != nil {
+		panic(err)
+	}
+	return pow
+}
+
+// PoW256 is LxrPoW256, returning an error rather than panicking
+func (lx LxrPow) PoW256(hash []byte, nonce uint64) (pow Pow256, err error) {
+	LHash, state, err := lx.translate(hash, nonce)
+	if err != nil {
+		return pow, err
+	}
+	binary.BigEndian.PutUint64(pow[:], mixState(hash, state))
+	var translated [48]byte
+	copy(translated[:], LHash[:])
+	binary.BigEndian.PutUint64(translated[40:], state)
+	sum := sha256.Sum256(translated[:])
+	copy(pow[8:], sum[:24])
+	return pow, nil
+}
+
+// Verify256
+// Reports if the claimed 256 bit proof of work is the proof of work of the hash
+// and nonce.  A hash that is not 32 bytes long never verifies.
+func (lx LxrPow) Verify256(hash []byte, nonce uint64, claimedPow Pow256) bool {
+	pow, err := lx.PoW256(hash, nonce)
+	return err == nil && pow == claimedPow
+}
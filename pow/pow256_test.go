@@ -0,0 +1,133 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sort"
+	"testing"
+)
+
+func TestPoW256(t *testing.T) {
+	lx, err := New(Options{Loops: 16, Bits: 12, Passes: 6, Store: NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+
+	hash := sha256.Sum256([]byte("pow256"))
+	seen := map[Pow256]bool{}
+	for nonce := uint64(0); nonce < 1000; nonce++ {
+		p := lx.LxrPoW256(hash[:], nonce)
+		if p.Uint64() != lx.LxrPoW(hash[:], nonce) {
+			t.Fatalf("nonce %d: leading 64 bits %016x are not LxrPoW %016x", nonce, p.Uint64(), lx.LxrPoW(hash[:], nonce))
+		}
+		if seen[p] {
+			t.Fatalf("nonce %d: repeated PoW %v", nonce, p)
+		}
+		seen[p] = true
+		if !lx.Verify256(hash[:], nonce, p) {
+			t.Fatalf("nonce %d: PoW does not verify", nonce)
+		}
+		p[31] ^= 1
+		if lx.Verify256(hash[:], nonce, p) {
+			t.Fatalf("nonce %d: a changed PoW verifies", nonce)
+		}
+	}
+	if _, err := lx.PoW256(hash[:31], 1); !errors.Is(err, ErrHashLength) {
+		t.Errorf("expected ErrHashLength, got %v", err)
+	}
+}
+
+// mixKernel returns a nonzero k with mixState(hash, s) == mixState(hash, s^k) for
+// every s.  mixState is affine in the state, and its linear part has rank 63, so
+// exactly one such k exists.
+func mixKernel(hash []byte) uint64 {
+	zero := mixState(hash, 0)
+	var basis [64]struct{ v, combo uint64 } // Reduced images, by leading bit, and the bits combined to give them
+	for i := 0; i < 64; i++ {
+		v, combo := mixState(hash, 1<<i)^zero, uint64(1)<<i
+		for b := 63; b >= 0 && v != 0; b-- {
+			if v>>b&1 == 0 {
+				continue
+			}
+			if basis[b].v == 0 {
+				basis[b].v, basis[b].combo = v, combo
+				break
+			}
+			v, combo = v^basis[b].v, combo^basis[b].combo
+		}
+		if v == 0 {
+			return combo
+		}
+	}
+	return 0
+}
+
+// Nonces whose 64 bit PoWs tie are still told apart by the 256 bit PoW
+func TestPoW256_Ties(t *testing.T) {
+	lx, err := New(Options{Loops: 0, Bits: 8, Passes: 6, Store: NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+
+	// With no loops, the state is mixState of the nonce, so nonces differing by
+	// the kernel reach the same state and the same 64 bit PoW
+	hash := sha256.Sum256([]byte("ties"))
+	k := mixKernel(hash[:])
+	if k == 0 {
+		t.Fatal("no kernel found for the mix")
+	}
+	for nonce := uint64(1); nonce <= 100; nonce++ {
+		a, b := lx.LxrPoW256(hash[:], nonce), lx.LxrPoW256(hash[:], nonce^k)
+		if a.Uint64() != b.Uint64() {
+			t.Fatalf("nonces %x and %x should tie on the 64 bit PoW", nonce, nonce^k)
+		}
+		if a == b {
+			t.Fatalf("nonces %x and %x tie on the 256 bit PoW %v", nonce, nonce^k, a)
+		}
+	}
+}
+
+func TestPow256_Ordering(t *testing.T) {
+	values := []Pow256{
+		Pow256FromUint64(0),
+		{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+		Pow256FromUint64(1),
+		{0xFF, 0xFF, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+		{0xFF, 0xFF, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2},
+		Pow256FromUint64(0xFFFF000000000001),
+		Pow256FromUint64(^uint64(0)),
+	}
+	for i := range values {
+		for j := range values {
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := values[i].Cmp(values[j]); got != want {
+				t.Errorf("Cmp(%v, %v) = %d, expected %d", values[i], values[j], got, want)
+			}
+			if values[i].Less(values[j]) != (i < j) || values[i].Beats(values[j]) != (i > j) {
+				t.Errorf("Less or Beats of %v and %v is wrong", values[i], values[j])
+			}
+		}
+	}
+	shuffled := []Pow256{values[4], values[0], values[6], values[2], values[5], values[1], values[3]}
+	sort.Slice(shuffled, func(i, j int) bool { return shuffled[i].Less(shuffled[j]) })
+	for i := range values {
+		if shuffled[i] != values[i] {
+			t.Fatalf("sorted %d is %v, expected %v", i, shuffled[i], values[i])
+		}
+	}
+	if !(Pow256{}).IsZero() || values[1].IsZero() {
+		t.Error("IsZero is wrong")
+	}
+	if values[5].Uint64() != 0xFFFF000000000001 {
+		t.Error("Uint64 does not return the leading 64 bits")
+	}
+}
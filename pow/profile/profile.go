@@ -0,0 +1,176 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+// Package profile measures the hash rate of LxrPoW and how it uses the ByteMap,
+// so performance can be tracked across changes and machines.
+package profile
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pegnet/LXRPow/pow"
+)
+
+// Config
+// How a profile is run
+type Config struct {
+	Duration   time.Duration // How long to hash for
+	Instances  int           // Goroutines hashing at once; 0 uses GOMAXPROCS
+	CacheBytes int           // Size of the simulated CPU cache; 0 uses DefaultCacheBytes
+	Samples    int           // Hashes traced through the simulated cache; 0 uses DefaultSamples
+}
+
+// DefaultCacheBytes is the simulated cache size, about the last level cache of a desktop CPU
+const DefaultCacheBytes = 32 << 20
+
+// DefaultSamples is the number of hashes traced through the simulated cache
+const DefaultSamples = 2000
+
+// CacheReport
+// How the ByteMap reads of LxrPoW behave in a simulated CPU cache.  The cache is
+// 8 way set associative with 64 byte lines and least recently used replacement.
+type CacheReport struct {
+	ByteMapBytes  uint64  `json:"byteMapBytes"`  // Size of the ByteMap
+	CacheBytes    int     `json:"cacheBytes"`    // Size of the simulated cache
+	ReadsPerHash  float64 `json:"readsPerHash"`  // ByteMap reads made by each hash
+	LinesPerHash  float64 `json:"linesPerHash"`  // Distinct 64 byte lines read by each hash
+	MissRate      float64 `json:"missRate"`      // Fraction of reads that miss the simulated cache
+	MissesPerHash float64 `json:"missesPerHash"` // Simulated cache misses for each hash
+}
+
+// Result
+// The measurements of one profile
+type Result struct {
+	Loops        int         `json:"loops"`
+	Bits         int         `json:"bits"`
+	Passes       int         `json:"passes"`
+	Instances    int         `json:"instances"`
+	Hashes       uint64      `json:"hashes"`
+	Seconds      float64     `json:"seconds"`
+	HashesPerSec float64     `json:"hashesPerSec"`
+	NsPerOp      float64     `json:"nsPerOp"` // Wall time per hash on one instance
+	Cache        CacheReport `json:"cache"`
+}
+
+// Run
+// Hashes with the LxrPow for the configured duration and reports the hash rate,
+// along with a simulation of how its ByteMap reads use the CPU cache.
+func Run(lx *pow.LxrPow, cfg Config) Result {
+	if cfg.Instances <= 0 {
+		cfg.Instances = runtime.GOMAXPROCS(0)
+	}
+	r := Result{Loops: lx.Loops, Bits: lx.Bits(), Passes: lx.Passes, Instances: cfg.Instances}
+
+	var hashes atomic.Uint64
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < cfg.Instances; i++ {
+		wg.Add(1)
+		go func(instance int) {
+			defer wg.Done()
+			hash := sha256.Sum256([]byte{byte(instance)})
+			nonce := uint64(instance) << 48
+			for !stop.Load() {
+				// Count in batches so the counter is not contended
+				for j := 0; j < 64; j++ {
+					nonce++
+					lx.LxrPoW(hash[:], nonce)
+				}
+				hashes.Add(64)
+			}
+		}(i)
+	}
+	time.Sleep(cfg.Duration)
+	stop.Store(true)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	r.Hashes = hashes.Load()
+	r.Seconds = elapsed.Seconds()
+	if r.Hashes > 0 {
+		r.HashesPerSec = float64(r.Hashes) / r.Seconds
+		r.NsPerOp = float64(elapsed.Nanoseconds()) * float64(cfg.Instances) / float64(r.Hashes)
+	}
+	r.Cache = SimulateCache(lx, cfg.CacheBytes, cfg.Samples)
+	return r
+}
+
+// SimulateCache
+// Traces the ByteMap reads of samples hashes through a simulated cache of the given size
+func SimulateCache(lx *pow.LxrPow, cacheBytes, samples int) CacheReport {
+	if cacheBytes <= 0 {
+		cacheBytes = DefaultCacheBytes
+	}
+	if samples <= 0 {
+		samples = DefaultSamples
+	}
+	c := newCache(cacheBytes)
+	report := CacheReport{ByteMapBytes: lx.MapSize, CacheBytes: cacheBytes}
+
+	var reads, lines, misses uint64
+	hash := sha256.Sum256([]byte("profile"))
+	seen := make(map[uint64]struct{})
+	// Warm the cache with as many hashes again before counting misses
+	for i := 0; i < 2*samples; i++ {
+		counting := i >= samples
+		for k := range seen {
+			delete(seen, k)
+		}
+		lx.Trace(hash[:], binary.BigEndian.Uint64(hash[:])+uint64(i), func(index uint64) {
+			line := index / lineBytes
+			miss := c.access(line)
+			if counting {
+				reads++
+				seen[line] = struct{}{}
+				if miss {
+					misses++
+				}
+			}
+		})
+		if counting {
+			lines += uint64(len(seen))
+		}
+	}
+	report.ReadsPerHash = float64(reads) / float64(samples)
+	report.LinesPerHash = float64(lines) / float64(samples)
+	report.MissesPerHash = float64(misses) / float64(samples)
+	if reads > 0 {
+		report.MissRate = float64(misses) / float64(reads)
+	}
+	return report
+}
+
+const lineBytes = 64 // Bytes in a cache line
+const ways = 8       // Lines in a cache set
+
+// cache is an LRU set associative cache of line numbers
+type cache struct {
+	sets [][ways]uint64 // Line number + 1 of each way, most recently used first; 0 is empty
+}
+
+func newCache(cacheBytes int) *cache {
+	sets := cacheBytes / lineBytes / ways
+	if sets < 1 {
+		sets = 1
+	}
+	return &cache{sets: make([][ways]uint64, sets)}
+}
+
+// access reads a line through the cache, and returns true if it missed
+func (c *cache) access(line uint64) (miss bool) {
+	set := &c.sets[line%uint64(len(c.sets))]
+	tag := line + 1
+	i := 0
+	for ; i < ways-1 && set[i] != tag; i++ {
+	}
+	miss = set[i] != tag // if it missed, the least recently used line is evicted
+	copy(set[1:i+1], set[:i])
+	set[0] = tag
+	return miss
+}
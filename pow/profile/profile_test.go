@@ -0,0 +1,58 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package profile
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pegnet/LXRPow/pow"
+)
+
+func TestRun(t *testing.T) {
+	lx, err := pow.New(pow.Options{Loops: 4, Bits: 16, Passes: 6, Store: pow.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Run(lx, Config{Duration: 50 * time.Millisecond, Instances: 2, Samples: 100})
+	if r.Hashes == 0 || r.HashesPerSec <= 0 || r.NsPerOp <= 0 {
+		t.Errorf("no hashing measured: %+v", r)
+	}
+	if r.Bits != 16 || r.Loops != 4 {
+		t.Errorf("wrong parameters reported: %+v", r)
+	}
+	if r.Cache.ReadsPerHash != 4*40 {
+		t.Errorf("expected %d reads per hash, got %f", 4*40, r.Cache.ReadsPerHash)
+	}
+}
+
+func TestSimulateCache(t *testing.T) {
+	lx, err := pow.New(pow.Options{Loops: 16, Bits: 16, Passes: 6, Store: pow.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A 64 KB ByteMap fits in a 1 MB cache, so a warm cache never misses
+	if r := SimulateCache(lx, 1<<20, 200); r.MissRate != 0 {
+		t.Errorf("expected no misses, got %+v", r)
+	}
+	// but mostly misses a 4 KB cache
+	if r := SimulateCache(lx, 4<<10, 200); r.MissRate < .9 {
+		t.Errorf("expected mostly misses, got %+v", r)
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := newCache(lineBytes * ways) // a single set
+	for line := uint64(0); line < ways; line++ {
+		if !c.access(line) {
+			t.Fatalf("line %d hit an empty cache", line)
+		}
+	}
+	if c.access(0) {
+		t.Fatal("line 0 should still be cached")
+	}
+	c.access(ways) // evicts line 1, the least recently used
+	if !c.access(1) {
+		t.Error("line 1 should have been evicted")
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// TableDirEnv is the environment variable that overrides the default ByteMap cache directory
+const TableDirEnv = "LXRPOW_TABLE_DIR"
+
+// TableStore
+// Persists ByteMap tables by name so they only have to be generated once.
+type TableStore interface {
+	Exists(name string) bool             // True if a table has been saved under the name
+	Load(name string) ([]byte, error)    // Returns the table saved under the name
+	Save(name string, data []byte) error // Saves the table under the name
+}
+
+// TableMapper
+// Implemented by TableStores that can map a table into memory rather than read
+// it onto the heap.  The table must not be written to, and must not be used
+// after unmap is called.
+type TableMapper interface {
+	Map(name string) (data []byte, unmap func() error, err error)
+}
+
+// TableContextSaver
+// Implemented by TableStores that can stop saving a table when the context is done.
+// A table that is not completely saved must not be left in the store.
+type TableContextSaver interface {
+	SaveContext(ctx context.Context, name string, data []byte) error
+}
+
+// TableLocker
+// Implemented by TableStores shared between processes.  Lock takes an exclusive
+// lock on the table name, waiting for any other process holding it, until unlock
+// is called.  It gives up with the context's error when the context is done.
+// LoadTable holds the lock while it generates and saves a table, so processes
+// starting together generate it once, and the rest load the saved table.
+type TableLocker interface {
+	Lock(ctx context.Context, name string) (unlock func() error, err error)
+}
+
+// DefaultTableDir
+// Returns the directory used to cache ByteMap tables when none is configured.
+// LXRPOW_TABLE_DIR is used if it is set, otherwise ~/.lxrpow
+func DefaultTableDir() (string, error) {
+	if dir := os.Getenv(TableDirEnv); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return "", fmt.Errorf("%w: no home directory and %s is not set: %v", ErrCacheDirUnavailable, TableDirEnv, err)
+	}
+	return filepath.Join(home, ".lxrpow"), nil
+}
+
+// DirStore
+// A TableStore that keeps each table in a file under the Root directory
+type DirStore struct {
+	Root string
+}
+
+// NewDirStore
+// Return a DirStore rooted at the given directory.  If root is empty, the
+// DefaultTableDir is used.
+func NewDirStore(root string) (*DirStore, error) {
+	if root == "" {
+		dir, err := DefaultTableDir()
+		if err != nil {
+			return nil, err
+		}
+		root = dir
+	}
+	return &DirStore{Root: root}, nil
+}
+
+// Path returns the file the table with the given name is kept in
+func (d *DirStore) Path(name string) string {
+	return filepath.Join(d.Root, name)
+}
+
+func (d *DirStore) Exists(name string) bool {
+	_, err := os.Stat(d.Path(name))
+	return err == nil
+}
+
+func (d *DirStore) Load(name string) ([]byte, error) {
+	return os.ReadFile(d.Path(name))
+}
+
+// Map memory maps the table read only, so processes loading the same table
+// share its pages.  Only supported on Linux.
+func (d *DirStore) Map(name string) (data []byte, unmap func() error, err error) {
+	return mmapFile(d.Path(name))
+}
+
+// Lock takes an advisory lock on the file name + ".lock" in the Root directory,
+// creating the directory if needed.  Lock files are left in place, since removing
+// them would race with processes waiting on them.  Locking is only supported on
+// unix systems; elsewhere Lock does not wait, and processes starting together may
+// each generate the table, though saves are atomic so the table is never corrupt.
+func (d *DirStore) Lock(ctx context.Context, name string) (unlock func() error, err error) {
+	if err := os.MkdirAll(d.Root, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("%w: could not create the directory %s: %v", ErrCacheDirUnavailable, d.Root, err)
+	}
+	return lockFile(ctx, d.Path(name)+".lock")
+}
+
+// Save writes the table to disk, creating the Root directory if needed.  The
+// table is written to a temporary file and renamed into place, so no other process
+// can load a partly written table.
+func (d *DirStore) Save(name string, data []byte) error {
+	return d.SaveContext(context.Background(), name, data)
+}
+
+// SaveContext is Save, stopping and removing the partly written table when the
+// context is done
+func (d *DirStore) SaveContext(ctx context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(d.Root, os.ModePerm); err != nil {
+		return fmt.Errorf("%w: could not create the directory %s: %v", ErrCacheDirUnavailable, d.Root, err)
+	}
+	return writeFile(ctx, d.Path(name), data)
+}
+
+// MemStore
+// A TableStore that keeps tables in memory.  Mostly useful for testing, where
+// nothing should be written to disk.  Tables are shared, not copied.
+type MemStore struct {
+	mu     sync.Mutex
+	tables map[string][]byte
+}
+
+// NewMemStore returns an empty MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{tables: make(map[string][]byte)}
+}
+
+func (m *MemStore) Exists(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.tables[name]
+	return ok
+}
+
+func (m *MemStore) Load(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("table %s: %w", name, os.ErrNotExist)
+	}
+	return data, nil
+}
+
+func (m *MemStore) Save(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tables[name] = data
+	return nil
+}
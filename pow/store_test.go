@@ -0,0 +1,285 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package pow
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemStore(t *testing.T) {
+	store := NewMemStore()
+	lx, err := New(Options{Loops: 16, Bits: 12, Passes: 6, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.Exists(lx.TableName()) {
+		t.Fatal("table was not saved to the store")
+	}
+	lx.Close()
+
+	// A second instance must load the table rather than generate it again
+	dat, _ := store.Load(lx.TableName())
+	lx2, err := New(Options{Loops: 8, Bits: 12, Passes: 6, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx2.Close()
+	if &lx2.ByteMap[0] != &dat[HeaderSize] {
+		t.Error("table was not loaded from the store")
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tables")
+	t.Setenv(TableDirEnv, dir)
+
+	store, err := NewDirStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Root != dir {
+		t.Fatalf("expected root %s, got %s", dir, store.Root)
+	}
+
+	lx, err := New(Options{Loops: 16, Bits: 12, Passes: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	if !store.Exists(lx.TableName()) {
+		t.Fatal("table was not written to " + dir)
+	}
+	dat, err := store.Load(lx.TableName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dat[HeaderSize:], lx.ByteMap) {
+		t.Error("table on disk does not match the generated table")
+	}
+}
+
+func TestDirStoreMmap(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("memory mapped tables are only supported on linux")
+	}
+	dir := t.TempDir()
+
+	// The first instance generates the table, then maps the saved file
+	lx, err := New(Options{Loops: 16, Bits: 12, Passes: 6, TableDir: dir, Mmap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lx.unmap == nil {
+		t.Fatal("generated table was not mapped after it was saved")
+	}
+	heap, err := New(Options{Loops: 16, Bits: 12, Passes: 6, TableDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer heap.Close()
+	if heap.unmap != nil {
+		t.Error("table was mapped without asking")
+	}
+	if !bytes.Equal(lx.ByteMap, heap.ByteMap) {
+		t.Error("mapped and heap tables differ")
+	}
+	hash := [32]byte{1, 2, 3}
+	if lx.LxrPoW(hash[:], 7) != heap.LxrPoW(hash[:], 7) {
+		t.Error("mapped and heap tables give different PoW")
+	}
+	if err := lx.Close(); err != nil {
+		t.Error(err)
+	}
+	if lx.ByteMap != nil {
+		t.Error("ByteMap still set after Close")
+	}
+}
+
+// Saving a mapped table copies it, since the mapping is read only, and generating
+// over it releases the mapping
+func TestDirStoreMmap_SaveTable(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("memory mapped tables are only supported on linux")
+	}
+	dir := t.TempDir()
+	lx, err := New(Options{Loops: 16, Bits: 12, Passes: 6, TableDir: dir, Mmap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lx.Close()
+	if lx.unmap == nil {
+		t.Fatal("table was not mapped")
+	}
+	saved := filepath.Join(t.TempDir(), "saved.dat")
+	if err := lx.SaveTable(saved); err != nil {
+		t.Fatal(err)
+	}
+	dat, err := os.ReadFile(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byteMap, err := VerifyTable(dat, NewTableHeader(12, 6, GeneratorLegacy, lx.ByteMap), false); err != nil || !bytes.Equal(byteMap, lx.ByteMap) {
+		t.Errorf("saved table does not verify: %v", err)
+	}
+
+	if err := lx.GenerateTableContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if lx.unmap != nil || lx.release != nil {
+		t.Error("generating did not release the mapped table")
+	}
+	if sealed := lx.sealTable(); &sealed[HeaderSize] != &lx.ByteMap[0] {
+		t.Error("a generated table was copied to be saved")
+	}
+}
+
+func TestDirStoreSaveContext(t *testing.T) {
+	dir := t.TempDir()
+	store := &DirStore{Root: dir}
+	files := func() (names []string) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := store.SaveContext(ctx, "table.dat", make([]byte, 3*writeChunk)); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if names := files(); len(names) != 0 {
+		t.Errorf("cancelled save left %v behind", names)
+	}
+
+	// Saves replace the table whole, leaving no temporary files
+	for _, b := range []byte{1, 2} {
+		data := bytes.Repeat([]byte{b}, writeChunk+5)
+		if err := store.Save("table.dat", data); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := store.Load("table.dat"); !bytes.Equal(got, data) {
+			t.Errorf("save %d was not read back", b)
+		}
+	}
+	if names := files(); len(names) != 1 || names[0] != "table.dat" {
+		t.Errorf("expected only table.dat, got %v", names)
+	}
+	if info, err := os.Stat(store.Path("table.dat")); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("table saved with mode %v, %v", info.Mode(), err)
+	}
+}
+
+func TestDirStoreLock(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" || runtime.GOOS == "js" {
+		t.Skip("table locks are only supported on unix systems")
+	}
+	store := &DirStore{Root: filepath.Join(t.TempDir(), "tables")}
+	unlock, err := store.Lock(context.Background(), "table.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*lockPoll)
+	defer cancel()
+	if _, err := store.Lock(ctx, "table.dat"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected to wait for the lock until the deadline, got %v", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = store.Lock(context.Background(), "table.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+}
+
+func TestDirStoreLock_LoadTable(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" || runtime.GOOS == "js" {
+		t.Skip("table locks are only supported on unix systems")
+	}
+	store := &DirStore{Root: t.TempDir()}
+
+	// Another process holds the lock while it generates the table
+	other, err := New(Options{Loops: 16, Bits: 11, Passes: 6, Store: NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, table := other.TableName(), other.sealTable()
+	other.Close() // so the table is not shared in this process
+	unlock, err := store.Lock(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var generated atomic.Bool
+	loaded := make(chan error, 1)
+	go func() {
+		lx, err := New(Options{Loops: 16, Bits: 11, Passes: 6, Store: store,
+			Progress: func(Progress) { generated.Store(true) }})
+		if err == nil {
+			lx.Close()
+		}
+		loaded <- err
+	}()
+	select {
+	case err := <-loaded:
+		t.Fatalf("table loaded while another process held the lock: %v", err)
+	case <-time.After(3 * lockPoll):
+	}
+	if err := store.Save(name, table); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if err := <-loaded; err != nil {
+		t.Fatal(err)
+	}
+	if generated.Load() {
+		t.Error("table was generated again rather than loaded once the lock was released")
+	}
+}
+
+func TestDirStore_CacheDirUnavailable(t *testing.T) {
+	// A file where the Root directory should be, so it can never be created
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	store := &DirStore{Root: filepath.Join(file, "tables")}
+
+	tests := []struct {
+		name string
+		call func(t *testing.T) error
+	}{
+		{"no home", func(t *testing.T) error {
+			t.Setenv(TableDirEnv, "")
+			t.Setenv("HOME", "")
+			_, err := NewDirStore("")
+			return err
+		}},
+		{"lock", func(*testing.T) error {
+			_, err := store.Lock(context.Background(), "table.dat")
+			return err
+		}},
+		{"save", func(*testing.T) error { return store.Save("table.dat", []byte{1}) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.call(t); !errors.Is(err, ErrCacheDirUnavailable) {
+				t.Errorf("expected ErrCacheDirUnavailable, got %v", err)
+			}
+		})
+	}
+}
@@ -3,11 +3,12 @@
 package pow
 
 import (
-	"bufio"
+	"context"
 	"fmt"
+	"log/slog"
 	"math"
 	"os"
-	"os/user"
+	"path/filepath"
 	"time"
 )
 
@@ -19,129 +20,322 @@ import (
 //
 // Bits is the number of bits used to address the ByteMap. If less than 8, set to 8.
 // Passes is the number of shuffles of the ByteMap performed.  Each pass shuffles all byte values in the map
+//
+// Init panics on any error; New returns errors instead.
 func (lx *LxrPow) Init(Loops, Bits, Passes int) *LxrPow {
+	if err := lx.InitContext(context.Background(), Loops, Bits, Passes); err != nil {
+		panic(err)
+	}
+	return lx
+}
+
+// InitContext
+// Initializes the hash as Init does, but returns errors rather than panicking, and
+// stops loading or generating the ByteMap when the context is done.
+func (lx *LxrPow) InitContext(ctx context.Context, Loops, Bits, Passes int) error {
+	return lx.init(ctx, Options{Loops: Loops, Bits: Bits, Passes: Passes})
+}
+
+// init sets up the LxrPow from the given options and loads the ByteMap
+func (lx *LxrPow) init(ctx context.Context, opts Options) error {
+	Bits := opts.Bits
 	if Bits < 8 {
 		Bits = 8
 	}
 	if Bits > 32 {
-		panic("we do not allow Byte Maps greater than 4 GB in size at this time.")
+		return fmt.Errorf("%w: %d bits", ErrBitsOutOfRange, opts.Bits)
 	}
 	// Negative loops are floored at zero
+	Loops := opts.Loops
 	if Loops < 0 {
 		Loops = 0
 	}
 	lx.MapSize = uint64(math.Pow(2, float64(Bits)))
-	lx.Passes = Passes
+	lx.Passes = opts.Passes
 	lx.Loops = Loops
-	lx.ReadTable()
-	return lx
+	lx.Store = opts.Store
+	lx.TrustCache = opts.TrustCache
+	lx.Mmap = opts.Mmap
+	lx.Generator = opts.Generator
+	lx.Progress = opts.Progress
+	lx.Logger = opts.Logger
+	if _, err := LookupGenerator(lx.generator()); err != nil {
+		return err
+	}
+	if lx.Store == nil {
+		store, err := NewDirStore(opts.TableDir)
+		if err != nil {
+			return err
+		}
+		lx.Store = store
+	}
+	return lx.acquireTable(ctx)
 }
 
 // ReadTable attempts to load the ByteMap from disk.
 // If that doesn't exist, a new one will be generated and saved.
+//
+// ReadTable panics on any error; LoadTable returns errors instead.
 func (lx *LxrPow) ReadTable() {
-	u, err := user.Current()
-	if err != nil {
+	if err := lx.LoadTable(); err != nil {
 		panic(err)
 	}
-	userPath := u.HomeDir
-	lxrPowPath := userPath + "/.lxrpow"
-	err = os.MkdirAll(lxrPowPath, os.ModePerm)
-	if err != nil {
-		panic(fmt.Sprintf("Could not create the directory %s", lxrPowPath))
+}
+
+// LoadTable attempts to load the ByteMap from the table store.
+// If that doesn't exist, a new one will be generated and saved.
+func (lx *LxrPow) LoadTable() error {
+	return lx.LoadTableContext(context.Background())
+}
+
+// LoadTableContext
+// Loads the ByteMap as LoadTable does, but stops when the context is done.  If it
+// stops while generating the ByteMap, nothing is saved; if it stops while saving,
+// the partly written table is removed.  Either way the context's error is returned
+// and the LxrPow is left without a ByteMap.
+func (lx *LxrPow) LoadTableContext(ctx context.Context) error {
+	if lx.Store == nil {
+		store, err := NewDirStore("")
+		if err != nil {
+			return err
+		}
+		lx.Store = store
 	}
-	bits := math.Log2(float64(lx.MapSize))
-	filename := fmt.Sprintf(lxrPowPath+"/lxrpow-%04x-passes-%02d-bits.dat", lx.Passes, int64(bits))
+	filename := lx.TableName()
+	log := lx.log().With("table", filename)
 	// Try and load our byte map.
-	fmt.Printf("Reading ByteMap Table %s\n", filename)
+	log.Info("reading ByteMap table")
 
 	start := time.Now()
-	dat, err := os.ReadFile(filename)
-	// If loading fails, or it is the wrong size, generate it.  Otherwise just use it.
-	if err != nil || len(dat) != int(lx.MapSize) {
-		fmt.Println("Table not found, Generating ByteMap Table")
-		lx.GenerateTable()
-		fmt.Println("Writing ByteMap Table ")
-		lx.WriteTable(filename)
-	} else {
-		lx.ByteMap = dat
+	want := TableHeader{
+		Version:   HeaderVersion,
+		Bits:      uint16(lx.Bits()),
+		Passes:    uint32(lx.Passes),
+		Generator: lx.generator(),
+		Size:      lx.MapSize,
+	}
+	err := lx.loadTable(filename, want)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		lx.Close()
+		return ctxErr
+	}
+	// If loading fails, another process may be generating the table.  Take the
+	// store's lock on it, so only one process generates it, and load it again in
+	// case it was saved while waiting for the lock.
+	if err != nil {
+		if locker, ok := lx.Store.(TableLocker); ok {
+			log.Debug("waiting for the ByteMap table lock")
+			unlock, lockErr := locker.Lock(ctx, filename)
+			if lockErr != nil {
+				return lockErr
+			}
+			defer unlock()
+			err = lx.loadTable(filename, want)
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				lx.Close()
+				return ctxErr
+			}
+		}
+	}
+	// If loading fails, or the table does not verify, generate it.  Otherwise just use it.
+	if err != nil {
+		log.Info("table not loaded, generating ByteMap table", "reason", err)
+		if err := lx.GenerateTableContext(ctx); err != nil {
+			return err
+		}
+		log.Info("writing ByteMap table")
+		if err := saveTable(ctx, lx.Store, filename, lx.sealTable()); err != nil {
+			lx.Close()
+			return err
+		}
+		lx.owned = false // Stores such as MemStore keep the table they are given
+		// Swap the generated table for a mapping of the saved one, so it is shared
+		if lx.Mmap {
+			if err := lx.loadTable(filename, want); err != nil {
+				log.Warn("keeping ByteMap on the heap", "error", err)
+			}
+		}
+	}
+	log.Info("finished reading ByteMap table", "elapsed", time.Since(start), "mapped", lx.unmap != nil)
+	return nil
+}
+
+// loadTable loads and verifies the table from the store, mapping it into
+// memory if asked to and the store supports it.
+func (lx *LxrPow) loadTable(filename string, want TableHeader) error {
+	if !lx.Store.Exists(filename) {
+		return fmt.Errorf("table %s: %w", filename, os.ErrNotExist)
+	}
+	if mapper, ok := lx.Store.(TableMapper); ok && lx.Mmap {
+		dat, unmap, err := mapper.Map(filename)
+		if err == nil {
+			byteMap, err := VerifyTable(dat, want, lx.TrustCache)
+			if err != nil {
+				unmap()
+				return err
+			}
+			lx.Close()
+			lx.ByteMap, lx.table, lx.unmap = byteMap, dat, unmap
+			return nil
+		}
+		lx.log().Warn("could not map ByteMap table, loading it instead", "table", filename, "error", err)
+	}
+	dat, err := lx.Store.Load(filename)
+	if err != nil {
+		return err
+	}
+	byteMap, err := VerifyTable(dat, want, lx.TrustCache)
+	if err != nil {
+		return err
+	}
+	lx.Close()
+	lx.ByteMap, lx.table = byteMap, dat
+	return nil
+}
+
+// Bits returns the number of bits addressing the ByteMap
+func (lx *LxrPow) Bits() int {
+	return int(math.Log2(float64(lx.MapSize)))
+}
+
+// sealTable returns the ByteMap prefixed with its TableHeader, as it is cached.
+// The header is only written in place if this LxrPow generated the ByteMap and
+// has not shared it; mapped tables are read only, and shared ones belong to other
+// instances too, so they are copied.
+func (lx *LxrPow) sealTable() []byte {
+	table := lx.table
+	if !lx.owned || len(table) != HeaderSize+len(lx.ByteMap) || &table[HeaderSize] != &lx.ByteMap[0] {
+		table = make([]byte, HeaderSize+len(lx.ByteMap))
+		copy(table[HeaderSize:], lx.ByteMap)
 	}
-	fmt.Printf("Finished Reading ByteMap Table. Total time taken: %s\n", time.Since(start))
+	NewTableHeader(lx.Bits(), lx.Passes, lx.generator(), table[HeaderSize:]).Put(table)
+	return table
+}
+
+// TableName returns the name the ByteMap is saved under in the table store.
+// Tables built by generators other than the legacy generator are named by version.
+func (lx *LxrPow) TableName() string {
+	if g := lx.generator(); g != GeneratorLegacy {
+		return fmt.Sprintf("lxrpow-%04x-passes-%02d-bits-g%02d.dat", lx.Passes, lx.Bits(), g)
+	}
+	return fmt.Sprintf("lxrpow-%04x-passes-%02d-bits.dat", lx.Passes, lx.Bits())
 }
 
 // WriteTable caches the byteMap to disk so it only has to be generated once
+//
+// WriteTable panics on any error; SaveTable returns errors instead.
 func (lx *LxrPow) WriteTable(filename string) {
-	os.Remove(filename)
+	if err := lx.SaveTable(filename); err != nil {
+		panic(err)
+	}
+}
+
+// SaveTable caches the byteMap to disk so it only has to be generated once.
+// The ByteMap is written behind a TableHeader so it can be verified when loaded.
+func (lx *LxrPow) SaveTable(filename string) error {
+	return writeFile(context.Background(), filename, lx.sealTable())
+}
 
-	// open output file
-	fo, err := os.Create(filename)
+// saveTable saves the table to the store, through SaveContext if the store supports it
+func saveTable(ctx context.Context, store TableStore, name string, data []byte) error {
+	if saver, ok := store.(TableContextSaver); ok {
+		return saver.SaveContext(ctx, name, data)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return store.Save(name, data)
+}
+
+// writeChunk is how much of a table is written between checks of the context
+const writeChunk = 1 << 20
+
+// writeFile
+// Writes a table to the given file atomically.  The table is written to a temporary
+// file in the same directory, which is renamed over the file once complete, so a
+// reader never sees a partly written table.  If writing fails or the context is
+// done, the temporary file is removed.
+func writeFile(ctx context.Context, filename string, data []byte) (err error) {
+	fo, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp-*")
 	if err != nil {
-		panic(err)
+		return err
 	}
-	// close fo on exit and check for its returned error
 	defer func() {
-		if err := fo.Close(); err != nil {
-			panic(err)
+		if err != nil {
+			fo.Close()
+			os.Remove(fo.Name())
 		}
 	}()
 
-	// write a chunk
-	w := bufio.NewWriter(fo)
-	bufSize := 4096 // 4KiB
-	for i := 0; i < len(lx.ByteMap); i += bufSize {
-		j := i + bufSize
-		if j > len(lx.ByteMap) {
-			j = len(lx.ByteMap)
+	for i := 0; i < len(data); i += writeChunk {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
-		if nn, err := w.Write(lx.ByteMap[i:j]); err != nil {
-			panic(fmt.Sprintf("error writing ByteMap to disk: %d bytes written, %v", nn, err))
+		j := min(i+writeChunk, len(data))
+		if nn, err := fo.Write(data[i:j]); err != nil {
+			return fmt.Errorf("error writing ByteMap to disk: %d bytes written, %w", i+nn, err)
 		}
 	}
-	err = w.Flush()
-	if err != nil {
-		panic(err)
+	if err := fo.Chmod(0644); err != nil { // Temporary files are only readable by their owner
+		return err
+	}
+	if err := fo.Sync(); err != nil {
+		return err
+	}
+	if err := fo.Close(); err != nil {
+		return err
 	}
+	return os.Rename(fo.Name(), filename)
 }
 
-// GenerateTable generates the ByteMap.
-// Initializes the map with an incremental sequence of bytes,
-// then does P passes, shuffling each element in a deterministic manner.
+// GenerateTable generates the ByteMap with the LxrPow's Generator, reporting
+// progress to its Progress function if set.
+//
+// GenerateTable panics on any error; GenerateTableContext returns errors instead.
 func (lx *LxrPow) GenerateTable() {
-	var offset uint64 = 204598345089
-	lx.ByteMap = make([]byte, int(lx.MapSize))
-	// Our own "random" generator that really is just used to shuffle values
-	MapMask := lx.MapSize - 1
-	// The random index used to shuffle the ByteMap is itself computed through the ByteMap table
-	// in a deterministic pattern.
-	rand := func(i, r uint64) uint64 {
-		offset = offset<<9 ^ offset>>7 ^ i ^ r
-		return uint64(offset) & MapMask
-	}
-
-	// Fill the ByteMap with bytes ranging from 0 to 255.  As long as MapSize%256 == 0, this
-	// looping and masking works just fine.
-	fmt.Println("Initializing the Table")
-	for i := range lx.ByteMap {
-		lx.ByteMap[i] = byte(i)
-	}
-
-	// Now what we want to do is just mix it all up.  Take every byte in the ByteMap list, and exchange it
-	// for some other byte in the ByteMap list. Note that we do this over and over, mixing and more mixing
-	// the ByteMap, but maintaining the ratio of each byte value in the ByteMap list.
-	fmt.Println("Shuffling the Table")
-	period := time.Now().Unix()
-	var r uint64
-	for i := 0; i < lx.Passes; i++ {
-		fmt.Printf("Pass %2d ", i)
-		for i := range lx.ByteMap {
-			if (i+1)%1000 == 0 && time.Now().Unix()-period > 10 {
-				fmt.Printf(".")
-				period = time.Now().Unix()
-			}
-			r = rand(uint64(i), r)
-			lx.ByteMap[i], lx.ByteMap[r] = lx.ByteMap[r], lx.ByteMap[i]
-		}
-		fmt.Printf(" Index %10d Meg of %10d Meg -- Pass is %5.1f%% Complete\n",
-			len(lx.ByteMap)/1024000, len(lx.ByteMap)/1024000, float64(100))
+	if err := lx.GenerateTableContext(context.Background()); err != nil {
+		panic(err)
+	}
+}
+
+// GenerateTableContext
+// Generates the ByteMap as GenerateTable does, but stops when the context is done.
+// Generators that are not ContextGenerators can only be stopped before they start.
+// If generating stops, the partly shuffled ByteMap is dropped and the context's
+// error is returned.
+func (lx *LxrPow) GenerateTableContext(ctx context.Context) error {
+	g, err := LookupGenerator(lx.generator())
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	lx.Close() // Release any mapped or shared ByteMap it replaces
+	// Leave room for the TableHeader in front of the ByteMap, so it can be cached without a copy
+	lx.table = make([]byte, HeaderSize+int(lx.MapSize))
+	lx.ByteMap = lx.table[HeaderSize:]
+	lx.owned = true
+	if cg, ok := g.(ContextGenerator); ok {
+		err = cg.GenerateContext(ctx, lx.ByteMap, lx.Passes, lx.Progress)
+	} else {
+		g.Generate(lx.ByteMap, lx.Passes, lx.Progress)
+	}
+	if err != nil {
+		lx.ByteMap, lx.table, lx.owned = nil, nil, false
+	}
+	return err
+}
+
+// log returns the logger for the LxrPow, which discards everything if none was set
+func (lx *LxrPow) log() *slog.Logger {
+	return loggerOrDiscard(lx.Logger)
+}
+
+// generator returns the version of the generator used to build the ByteMap
+func (lx *LxrPow) generator() GeneratorVersion {
+	if lx.Generator == 0 {
+		return GeneratorLegacy
 	}
+	return lx.Generator
 }
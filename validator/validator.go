@@ -3,6 +3,8 @@ package validator
 import (
 	"crypto/sha256"
 	"fmt"
+	"log/slog"
+	"math"
 	"time"
 
 	"github.com/pegnet/LXRPow/accumulate"
@@ -12,8 +14,10 @@ import (
 type Validator struct {
 	URL        string
 	LX         *pow.LxrPow
+	Manager    *pow.Manager // Algorithms for each Settings; if nil, LX is used
 	BlockTimes []float64
-	OldDiff    uint64 // A working value
+	OldDiff    uint64       // A working value
+	Logger     *slog.Logger // Defaults to logging nothing
 }
 
 // NewValidator
@@ -21,6 +25,7 @@ func NewValidator(url string, lx *pow.LxrPow) *Validator {
 	v := new(Validator)
 	v.URL = url
 	v.LX = lx
+	v.Logger = pow.DiscardLogger()
 	return v
 }
 
@@ -29,16 +34,18 @@ func NewValidator(url string, lx *pow.LxrPow) *Validator {
 // entry of the block (first to be > difficulty)
 // Assumes submissions are sorted
 func (v *Validator) EndOfBlock(settings *accumulate.Settings, submissions []accumulate.Submission) (bool, int) {
-	if len(submissions) == 0 || submissions[len(submissions)-1].PoW < settings.Difficulty {
+	if len(submissions) == 0 || !settings.EndsBlock(submissions[len(submissions)-1]) {
 		return false, 0
 	}
+	lease := v.algorithm(*settings)
+	defer lease.Release()
 	valid := -1
 	i := len(submissions) - 1
 	for ; i >= 0; i-- {
-		if submissions[i].PoW < settings.Difficulty {
+		if !settings.EndsBlock(submissions[i]) {
 			i++ // Add back to the last valid
 			break
-		} else if accumulate.ValidateSubmission(v.LX, *settings, submissions[i]) {
+		} else if accumulate.ValidateSubmission(lease.Alg, *settings, submissions[i]) {
 			valid = i
 		}
 
@@ -51,14 +58,48 @@ func (v *Validator) EndOfBlock(settings *accumulate.Settings, submissions []accu
 func (v *Validator) TrimToBlock(settings accumulate.Settings, submissions []accumulate.Submission) []accumulate.Submission {
 
 	var PointWinners []accumulate.Submission
-	for _, s := range submissions {
-		if accumulate.ValidateSubmission(v.LX, settings, s) {
+	lease := v.algorithm(settings)
+	defer lease.Release()
+	valid := accumulate.ValidateSubmissions(lease.Alg, settings, submissions)
+	for i, s := range submissions {
+		if valid[i] {
 			PointWinners = append(PointWinners, s)
 		}
 	}
 	return PointWinners
 }
 
+// algorithm
+// Returns a lease on the PoW algorithm the settings activate, to be released once
+// the submissions are checked.  Submissions are only valid for the block of the
+// settings, so they are checked with the parameters of their block.  If the
+// algorithm can't be built, nothing validates.
+func (v *Validator) algorithm(settings accumulate.Settings) *pow.Lease {
+	if v.Manager == nil {
+		if v.LX == nil {
+			return &pow.Lease{}
+		}
+		return &pow.Lease{Alg: v.LX}
+	}
+	lease, err := v.Manager.Get(settings.AlgorithmKey())
+	if err != nil {
+		v.Logger.Error("no PoW algorithm for block", "block", settings.BlockIndex, "error", err)
+		return &pow.Lease{Alg: failAlgorithm{settings.AlgorithmKey()}}
+	}
+	return lease
+}
+
+// failAlgorithm verifies nothing; used when the algorithm of a block can't be built
+type failAlgorithm struct{ key pow.AlgorithmKey }
+
+func (f failAlgorithm) Key() pow.AlgorithmKey { return f.key }
+func (f failAlgorithm) PoW(hash []byte, nonce uint64) (uint64, error) {
+	return 0, fmt.Errorf("no PoW algorithm for %v", f.key)
+}
+func (f failAlgorithm) Meets(hash []byte, nonce, limit uint64) (uint64, bool) { return 0, false }
+func (f failAlgorithm) Verify(hash []byte, nonce, claimedPow uint64) bool     { return false }
+func (f failAlgorithm) Close() error                                          { return nil }
+
 // Start
 // Updates the settings on Accumulate
 func (v *Validator) Start() {
@@ -83,12 +124,12 @@ func (v *Validator) Start() {
 			if newDiff != newSettings.Difficulty {
 				v.OldDiff = newSettings.Difficulty
 				newSettings.Difficulty = newDiff
+				if newSettings.Uses256() { // The 256 bit difficulty follows the adjustment
+					newSettings.Difficulty256 = pow.Pow256FromUint64(newDiff)
+				}
 			}
 
 			// Need to add grading and point tracking
-			minutes := int(LastBlockTime) / 60
-			seconds := LastBlockTime - float64(minutes*60)
-
 			var sum float64
 			for _, v := range v.BlockTimes {
 				sum += v
@@ -96,26 +137,26 @@ func (v *Validator) Start() {
 			btl := float64(len(v.BlockTimes))
 
 			go func(submissions []accumulate.Submission) {
-				out := "TimeStamp                 DNIndex DNHash           BlockIndex Nonce            MinerIdx  Pow              Url\n"
+				log := v.Logger.With("block", settings.BlockIndex, "dnindex", settings.DNIndex)
 				for _, n := range submissions {
-					t := n.TimeStamp.Format("01/02/06 03:04:05.000")
-					url := accumulate.MiningADI.GetMinerUrl(n.MinerIdx)
-					out += fmt.Sprintf("%25s %7d %016x %10d %016x %9d %016x %s\n",
-						t, n.DNIndex, n.DNHash[:8], n.BlockIndex, n.Nonce, n.MinerIdx, n.PoW, url)
+					log.Debug("submission",
+						"timestamp", n.TimeStamp,
+						"dnhash", fmt.Sprintf("%016x", n.DNHash[:8]),
+						"nonce", fmt.Sprintf("%016x", n.Nonce),
+						"minerIdx", n.MinerIdx,
+						"pow", fmt.Sprintf("%016x", n.PoW),
+						"url", accumulate.MiningADI.GetMinerUrl(n.MinerIdx))
 				}
-				out += "TimeStamp                 DNIndex DNHash           BlockIndex Nonce            MinerIdx  Pow              Difficulty       Url\n"
-
-				out += fmt.Sprintf("TargetBlockTime=   %4d\n", settings.BlockTime)
-				out += fmt.Sprintf("AvgBlockTime=    %8.3f\n", sum/btl)
-				out += fmt.Sprintf("Difficulty=         %016x\n", settings.Difficulty)
-				out += fmt.Sprintf("PreviousDiff=       %016x\n", v.OldDiff)
-				out += fmt.Sprintf("BlockTime =         %d:%06.3f\n", minutes, seconds)
-				out += fmt.Sprintf("#submissions=       %d\n", len(submissions))
-				out += fmt.Sprintf("block number=       %d\n", settings.BlockIndex)
-				out += fmt.Sprintf("DNBlock number=     %d\n\n", settings.DNIndex)
-				fmt.Print(out)
+				log.Info("block complete",
+					"targetBlockTime", settings.BlockTime,
+					"avgBlockTime", sum/btl,
+					"difficulty", pow.Difficulty(settings.Difficulty),
+					"difficultyBits", pow.Difficulty(settings.Difficulty).LeadingBits(),
+					"previousDiff", pow.Difficulty(v.OldDiff),
+					"blockTime", time.Duration(LastBlockTime*float64(time.Second)),
+					"submissions", len(submissions))
 			}(submissions)
-			accumulate.MiningADI.AddSettings(newSettings)
+			accumulate.MiningADI.EndBlock(newSettings)
 
 		}
 
@@ -147,11 +188,13 @@ func (v *Validator) AdjustDifficulty(settings, newSettings accumulate.Settings)
 		if dPercent < -.5 {
 			dPercent = -.5
 		}
-		fDifficulty := float64(-settings.Difficulty)  // Use the 2's complement of the Difficulty because leading F's (in hex) are hard to deal with
-		nd := uint64(-(fDifficulty * (1 - dPercent))) // Edge closer by 1/5 the error since we are using a 128 blk average
-		v.BlockTimes = v.BlockTimes[:0]               // Clear the list of block times
+		// The chance of a solution grows by (1 - dPercent), so the work shrinks by it.
+		// Scale the work in parts per million, so the difficulty keeps its precision.
+		const ppm = 1000000
+		nd := pow.Difficulty(settings.Difficulty).Scale(ppm, uint64(math.Round((1-dPercent)*ppm)))
+		v.BlockTimes = v.BlockTimes[:0] // Clear the list of block times
 
-		return lastBlockTime, nd, uint16(settings.BlockIndex + 1)
+		return lastBlockTime, uint64(nd), uint16(settings.BlockIndex + 1)
 	}
 	return lastBlockTime, settings.Difficulty, uint16(settings.WindowBlockIndex)
 }